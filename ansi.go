@@ -1,6 +1,10 @@
 package chimp
 
-import "strings"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // Sequence represents an ANSI escape sequence.
 type Sequence string
@@ -35,6 +39,21 @@ func ApplyStyles(styles ...string) string {
 	return ansi.String()
 }
 
+// ApplyStylesStrict is like ApplyStyles, but returns an *InvalidColorError or
+// *UnknownStyleError for the first unrecognized style. Its position locates
+// the style within the styles joined by commas, as if they were written in a
+// single tag.
+func ApplyStylesStrict(styles ...string) (string, error) {
+	pos := Position{Line: 1, Column: 1}
+	for _, style := range styles {
+		if err := styleError(style, pos); err != nil {
+			return "", err
+		}
+		pos.advance([]byte(style + ","))
+	}
+	return ApplyStyles(styles...), nil
+}
+
 // Matches checks if the input matches the Style exactly or case-insensitively with an offset of 32.
 func (s Style) Matches(input string) bool {
 	// Exact match
@@ -58,6 +77,31 @@ func (s Style) ToSequence() Sequence {
 	return styleToSequence(s)
 }
 
+// ColorStyle returns the Style selecting color n of the 256-color palette as
+// the foreground, written as "Color(n)" in markup.
+func ColorStyle(n uint8) Style {
+	return Style(fmt.Sprintf("Color(%d)", n))
+}
+
+// BgStyle returns the Style selecting color n of the 256-color palette as the
+// background, written as "Bg(n)" in markup.
+func BgStyle(n uint8) Style {
+	return Style(fmt.Sprintf("Bg(%d)", n))
+}
+
+// RGBStyle returns the Style selecting a 24-bit foreground color, written as
+// "#rrggbb" in markup. The forms "#rgb" and "rgb(r,g,b)" are also accepted.
+func RGBStyle(r, g, b uint8) Style {
+	return Style(fmt.Sprintf("#%02x%02x%02x", r, g, b))
+}
+
+// BgRGBStyle returns the Style selecting a 24-bit background color, written as
+// "bg:#rrggbb" in markup. The "bg:" prefix also applies to the other
+// RGBStyle forms.
+func BgRGBStyle(r, g, b uint8) Style {
+	return Style(fmt.Sprintf("%s#%02x%02x%02x", truecolorBgPrefix, r, g, b))
+}
+
 // ANSI style names as exported Style constants and their corresponding Sequence constants.
 const (
 	// Special Cases
@@ -163,212 +207,332 @@ const (
 	SequenceBgBrightWhite   Sequence = "\033[107m"
 )
 
-// sequenceToStyle converts a Sequence to its corresponding Style.
-func sequenceToStyle(s Sequence) Style {
-	switch s {
-	case SequenceReset:
-		return StyleReset
-	case SequenceBold:
-		return StyleBold
-	case SequenceFaint:
-		return StyleFaint
-	case SequenceItalic:
-		return StyleItalic
-	case SequenceUnderline:
-		return StyleUnderline
-	case SequenceBlink:
-		return StyleBlink
-	case SequenceRapidBlink:
-		return StyleRapidBlink
-	case SequenceInverse:
-		return StyleInverse
-	case SequenceHidden:
-		return StyleHidden
-	case SequenceStrikethrough:
-		return StyleStrikethrough
+// styleTable pairs each named style with its sequence, in the order
+// suggestions prefer them. It is the single source of both styleToSequence and
+// sequenceToStyle.
+var styleTable = []struct {
+	style Style
+	seq   Sequence
+}{
+	{StyleReset, SequenceReset},
+
+	// Text Attributes
+	{StyleBold, SequenceBold},
+	{StyleFaint, SequenceFaint},
+	{StyleItalic, SequenceItalic},
+	{StyleUnderline, SequenceUnderline},
+	{StyleBlink, SequenceBlink},
+	{StyleRapidBlink, SequenceRapidBlink},
+	{StyleInverse, SequenceInverse},
+	{StyleHidden, SequenceHidden},
+	{StyleStrikethrough, SequenceStrikethrough},
 
 	// Foreground Colors
-	case SequenceBlack:
-		return StyleBlack
-	case SequenceRed:
-		return StyleRed
-	case SequenceGreen:
-		return StyleGreen
-	case SequenceYellow:
-		return StyleYellow
-	case SequenceBlue:
-		return StyleBlue
-	case SequenceMagenta:
-		return StyleMagenta
-	case SequenceCyan:
-		return StyleCyan
-	case SequenceWhite:
-		return StyleWhite
+	{StyleBlack, SequenceBlack},
+	{StyleRed, SequenceRed},
+	{StyleGreen, SequenceGreen},
+	{StyleYellow, SequenceYellow},
+	{StyleBlue, SequenceBlue},
+	{StyleMagenta, SequenceMagenta},
+	{StyleCyan, SequenceCyan},
+	{StyleWhite, SequenceWhite},
 
 	// Background Colors
-	case SequenceBgBlack:
-		return StyleBgBlack
-	case SequenceBgRed:
-		return StyleBgRed
-	case SequenceBgGreen:
-		return StyleBgGreen
-	case SequenceBgYellow:
-		return StyleBgYellow
-	case SequenceBgBlue:
-		return StyleBgBlue
-	case SequenceBgMagenta:
-		return StyleBgMagenta
-	case SequenceBgCyan:
-		return StyleBgCyan
-	case SequenceBgWhite:
-		return StyleBgWhite
+	{StyleBgBlack, SequenceBgBlack},
+	{StyleBgRed, SequenceBgRed},
+	{StyleBgGreen, SequenceBgGreen},
+	{StyleBgYellow, SequenceBgYellow},
+	{StyleBgBlue, SequenceBgBlue},
+	{StyleBgMagenta, SequenceBgMagenta},
+	{StyleBgCyan, SequenceBgCyan},
+	{StyleBgWhite, SequenceBgWhite},
 
 	// Bright Foreground Colors
-	case SequenceBrightBlack:
-		return StyleBrightBlack
-	case SequenceBrightRed:
-		return StyleBrightRed
-	case SequenceBrightGreen:
-		return StyleBrightGreen
-	case SequenceBrightYellow:
-		return StyleBrightYellow
-	case SequenceBrightBlue:
-		return StyleBrightBlue
-	case SequenceBrightMagenta:
-		return StyleBrightMagenta
-	case SequenceBrightCyan:
-		return StyleBrightCyan
-	case SequenceBrightWhite:
-		return StyleBrightWhite
+	{StyleBrightBlack, SequenceBrightBlack},
+	{StyleBrightRed, SequenceBrightRed},
+	{StyleBrightGreen, SequenceBrightGreen},
+	{StyleBrightYellow, SequenceBrightYellow},
+	{StyleBrightBlue, SequenceBrightBlue},
+	{StyleBrightMagenta, SequenceBrightMagenta},
+	{StyleBrightCyan, SequenceBrightCyan},
+	{StyleBrightWhite, SequenceBrightWhite},
 
 	// Bright Background Colors
-	case SequenceBgBrightBlack:
-		return StyleBgBrightBlack
-	case SequenceBgBrightRed:
-		return StyleBgBrightRed
-	case SequenceBgBrightGreen:
-		return StyleBgBrightGreen
-	case SequenceBgBrightYellow:
-		return StyleBgBrightYellow
-	case SequenceBgBrightBlue:
-		return StyleBgBrightBlue
-	case SequenceBgBrightMagenta:
-		return StyleBgBrightMagenta
-	case SequenceBgBrightCyan:
-		return StyleBgBrightCyan
-	case SequenceBgBrightWhite:
-		return StyleBgBrightWhite
+	{StyleBgBrightBlack, SequenceBgBrightBlack},
+	{StyleBgBrightRed, SequenceBgBrightRed},
+	{StyleBgBrightGreen, SequenceBgBrightGreen},
+	{StyleBgBrightYellow, SequenceBgBrightYellow},
+	{StyleBgBrightBlue, SequenceBgBrightBlue},
+	{StyleBgBrightMagenta, SequenceBgBrightMagenta},
+	{StyleBgBrightCyan, SequenceBgBrightCyan},
+	{StyleBgBrightWhite, SequenceBgBrightWhite},
+}
 
-	// Special Cases
-	case SequenceUnknown:
-		return StyleUnknown
-	case SequenceUnset:
-		return StyleUnset
+// maxStyleLen is the length of the longest named style, bounding the keys
+// produced by foldStyle.
+const maxStyleLen = len(StyleBgBrightMagenta)
+
+// styleSequences and sequenceStyles index styleTable and the special cases.
+// styleSequences is keyed by foldStyle.
+var styleSequences, sequenceStyles = indexStyles()
+
+// indexStyles builds the lookup maps for styleToSequence and sequenceToStyle.
+func indexStyles() (map[string]Sequence, map[Sequence]Style) {
+	styles := make(map[string]Sequence, len(styleTable)+2)
+	seqs := make(map[Sequence]Style, len(styleTable)+2)
+	add := func(style Style, seq Sequence) {
+		var buf [maxStyleLen]byte
+		styles[string(foldStyle(buf[:], string(style)))] = seq
+		seqs[seq] = style
+	}
+	for _, e := range styleTable {
+		add(e.style, e.seq)
+	}
+	add(StyleUnknown, SequenceUnknown)
+	add(StyleUnset, SequenceUnset)
+	return styles, seqs
+}
+
+// foldStyle writes the lookup key of a style name into buf, which must hold
+// maxStyleLen bytes, and returns it. As with Style.Matches, the first byte is
+// kept and the rest are lowercased. Names longer than buf, which cannot be
+// named styles, return nil.
+func foldStyle(buf []byte, name string) []byte {
+	if len(name) > len(buf) {
+		return nil
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if i > 0 && 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	return buf[:len(name)]
+}
+
+// suggestStyle returns the known style name closest to name, ignoring case,
+// or an empty string if none is within a small edit distance.
+func suggestStyle(name string) string {
+	best, bestDist := "", 3 // Suggest only within two edits
+	for _, e := range styleTable {
+		d := editDistance(strings.ToLower(name), strings.ToLower(string(e.style)))
+		if d < bestDist && d < len(name) {
+			best, bestDist = string(e.style), d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// sequenceToStyle converts a Sequence to its corresponding Style.
+func sequenceToStyle(s Sequence) Style {
+	if style, ok := sequenceStyles[s]; ok {
+		return style
+	}
+	if style, ok := paletteSequenceToStyle(s); ok {
+		return style
+	}
+	if style, ok := truecolorSequenceToStyle(s); ok {
+		return style
 	}
 	return StyleUnknown // Default for unrecognized sequences
 }
 
-// styleToSequence converts a Style to its corresponding Sequence.
+// styleToSequence converts a Style to its corresponding Sequence. Named styles
+// match as by Style.Matches.
 func styleToSequence(s Style) Sequence {
-	switch {
-	case StyleReset.Matches(string(s)):
-		return SequenceReset
-	case StyleBold.Matches(string(s)):
-		return SequenceBold
-	case StyleFaint.Matches(string(s)):
-		return SequenceFaint
-	case StyleItalic.Matches(string(s)):
-		return SequenceItalic
-	case StyleUnderline.Matches(string(s)):
-		return SequenceUnderline
-	case StyleBlink.Matches(string(s)):
-		return SequenceBlink
-	case StyleRapidBlink.Matches(string(s)):
-		return SequenceRapidBlink
-	case StyleInverse.Matches(string(s)):
-		return SequenceInverse
-	case StyleHidden.Matches(string(s)):
-		return SequenceHidden
-	case StyleStrikethrough.Matches(string(s)):
-		return SequenceStrikethrough
+	var buf [maxStyleLen]byte
+	if key := foldStyle(buf[:], string(s)); key != nil {
+		if seq, ok := styleSequences[string(key)]; ok {
+			return seq
+		}
+	}
+	if seq, ok := paletteStyleToSequence(s); ok {
+		return seq
+	}
+	if seq, ok := truecolorStyleToSequence(s); ok {
+		return seq
+	}
+	return SequenceUnknown // Default for unrecognized styles
+}
 
-	// Foreground Colors
-	case StyleBlack.Matches(string(s)):
-		return SequenceBlack
-	case StyleRed.Matches(string(s)):
-		return SequenceRed
-	case StyleGreen.Matches(string(s)):
-		return SequenceGreen
-	case StyleYellow.Matches(string(s)):
-		return SequenceYellow
-	case StyleBlue.Matches(string(s)):
-		return SequenceBlue
-	case StyleMagenta.Matches(string(s)):
-		return SequenceMagenta
-	case StyleCyan.Matches(string(s)):
-		return SequenceCyan
-	case StyleWhite.Matches(string(s)):
-		return SequenceWhite
+// paletteForms lists the parameterized 256-color styles with the SGR parameter
+// introducing each.
+var paletteForms = []struct {
+	prefix string
+	param  int
+}{
+	{"Color(", 38},
+	{"Bg(", 48},
+}
 
-	// Background Colors
-	case StyleBgBlack.Matches(string(s)):
-		return SequenceBgBlack
-	case StyleBgRed.Matches(string(s)):
-		return SequenceBgRed
-	case StyleBgGreen.Matches(string(s)):
-		return SequenceBgGreen
-	case StyleBgYellow.Matches(string(s)):
-		return SequenceBgYellow
-	case StyleBgBlue.Matches(string(s)):
-		return SequenceBgBlue
-	case StyleBgMagenta.Matches(string(s)):
-		return SequenceBgMagenta
-	case StyleBgCyan.Matches(string(s)):
-		return SequenceBgCyan
-	case StyleBgWhite.Matches(string(s)):
-		return SequenceBgWhite
+// paletteStyleToSequence converts a "Color(n)" or "Bg(n)" style to its
+// sequence. Indexes outside 0-255 are not recognized.
+func paletteStyleToSequence(s Style) (Sequence, bool) {
+	for _, form := range paletteForms {
+		arg, ok := styleArgs(string(s), form.prefix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil || n < 0 || n > 255 {
+			return SequenceUnknown, false
+		}
+		return Sequence(fmt.Sprintf("\033[%d;5;%dm", form.param, n)), true
+	}
+	return SequenceUnknown, false
+}
 
-	// Bright Foreground Colors
-	case StyleBrightBlack.Matches(string(s)):
-		return SequenceBrightBlack
-	case StyleBrightRed.Matches(string(s)):
-		return SequenceBrightRed
-	case StyleBrightGreen.Matches(string(s)):
-		return SequenceBrightGreen
-	case StyleBrightYellow.Matches(string(s)):
-		return SequenceBrightYellow
-	case StyleBrightBlue.Matches(string(s)):
-		return SequenceBrightBlue
-	case StyleBrightMagenta.Matches(string(s)):
-		return SequenceBrightMagenta
-	case StyleBrightCyan.Matches(string(s)):
-		return SequenceBrightCyan
-	case StyleBrightWhite.Matches(string(s)):
-		return SequenceBrightWhite
+// paletteSequenceToStyle converts a 256-color sequence to its "Color(n)" or
+// "Bg(n)" style.
+func paletteSequenceToStyle(s Sequence) (Style, bool) {
+	params, ok := sequenceParams(s)
+	if !ok || len(params) != 3 || params[1] != 5 || params[2] > 255 {
+		return StyleUnknown, false
+	}
+	switch params[0] {
+	case 38:
+		return ColorStyle(uint8(params[2])), true
+	case 48:
+		return BgStyle(uint8(params[2])), true
+	}
+	return StyleUnknown, false
+}
 
-	// Bright Background Colors
-	case StyleBgBrightBlack.Matches(string(s)):
-		return SequenceBgBrightBlack
-	case StyleBgBrightRed.Matches(string(s)):
-		return SequenceBgBrightRed
-	case StyleBgBrightGreen.Matches(string(s)):
-		return SequenceBgBrightGreen
-	case StyleBgBrightYellow.Matches(string(s)):
-		return SequenceBgBrightYellow
-	case StyleBgBrightBlue.Matches(string(s)):
-		return SequenceBgBrightBlue
-	case StyleBgBrightMagenta.Matches(string(s)):
-		return SequenceBgBrightMagenta
-	case StyleBgBrightCyan.Matches(string(s)):
-		return SequenceBgBrightCyan
-	case StyleBgBrightWhite.Matches(string(s)):
-		return SequenceBgBrightWhite
+// truecolorBgPrefix marks a 24-bit color style as applying to the background.
+const truecolorBgPrefix = "bg:"
 
-	// Special Cases
-	case StyleUnknown.Matches(string(s)):
-		return SequenceUnknown
-	case StyleUnset.Matches(string(s)):
-		return SequenceUnset
+// truecolorStyleToSequence converts a "#rrggbb", "#rgb" or "rgb(r,g,b)" style,
+// optionally prefixed with "bg:", to its 24-bit color sequence. Malformed or
+// out-of-range components are not recognized.
+func truecolorStyleToSequence(s Style) (Sequence, bool) {
+	text, param := string(s), 38
+	if strings.HasPrefix(text, truecolorBgPrefix) {
+		text, param = strings.TrimSpace(text[len(truecolorBgPrefix):]), 48
 	}
-	return SequenceUnknown // Default for unrecognized styles
+
+	var r, g, b uint8
+	var ok bool
+	if strings.HasPrefix(text, "#") {
+		r, g, b, ok = parseHexColor(text[1:])
+	} else if args, found := styleArgs(text, "rgb("); found {
+		r, g, b, ok = parseRGBArgs(args)
+	}
+	if !ok {
+		return SequenceUnknown, false
+	}
+	return Sequence(fmt.Sprintf("\033[%d;2;%d;%d;%dm", param, r, g, b)), true
+}
+
+// truecolorSequenceToStyle converts a 24-bit color sequence to its "#rrggbb"
+// or "bg:#rrggbb" style.
+func truecolorSequenceToStyle(s Sequence) (Style, bool) {
+	params, ok := sequenceParams(s)
+	if !ok || len(params) != 5 || params[1] != 2 {
+		return StyleUnknown, false
+	}
+	for _, p := range params[2:] {
+		if p > 255 {
+			return StyleUnknown, false
+		}
+	}
+	r, g, b := uint8(params[2]), uint8(params[3]), uint8(params[4])
+	switch params[0] {
+	case 38:
+		return RGBStyle(r, g, b), true
+	case 48:
+		return BgRGBStyle(r, g, b), true
+	}
+	return StyleUnknown, false
+}
+
+// parseHexColor parses the digits of a "#rrggbb" or "#rgb" color.
+func parseHexColor(digits string) (r, g, b uint8, ok bool) {
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	if len(digits) != 6 {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), true
+}
+
+// parseRGBArgs parses the comma-separated components of an "rgb(r,g,b)" color.
+func parseRGBArgs(args string) (r, g, b uint8, ok bool) {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 {
+		return 0, 0, 0, false
+	}
+	var rgb [3]uint8
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 || n > 255 {
+			return 0, 0, 0, false
+		}
+		rgb[i] = uint8(n)
+	}
+	return rgb[0], rgb[1], rgb[2], true
+}
+
+// colorArgs returns the argument of a style written in one of the
+// parameterized color forms, such as "208" for "Color(208)" or "ff8800" for
+// "bg:#ff8800", whether or not the argument is valid.
+func colorArgs(s string) (string, bool) {
+	forms := []string{"Color(", "Bg(", "rgb("}
+	if strings.HasPrefix(s, truecolorBgPrefix) {
+		s, forms = strings.TrimSpace(s[len(truecolorBgPrefix):]), forms[2:]
+	}
+	if strings.HasPrefix(s, "#") {
+		return s[1:], true
+	}
+	for _, prefix := range forms {
+		if len(s) >= len(prefix) && s[0] == prefix[0] && strings.EqualFold(s[1:len(prefix)], prefix[1:]) {
+			return strings.TrimSuffix(s[len(prefix):], ")"), true
+		}
+	}
+	return "", false
+}
+
+// styleArgs returns the text between the parentheses of a parameterized style
+// such as "Color(208)". The prefix, which includes the opening parenthesis,
+// matches like Style.Matches: first character exactly, the rest ignoring case.
+func styleArgs(s, prefix string) (string, bool) {
+	if len(s) <= len(prefix) || s[0] != prefix[0] || !strings.EqualFold(s[1:len(prefix)], prefix[1:]) {
+		return "", false
+	}
+	if s[len(s)-1] != ')' {
+		return "", false
+	}
+	return s[len(prefix) : len(s)-1], true
 }
@@ -1,6 +1,9 @@
 package chimp
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestApplyStyles(t *testing.T) {
 	tests := []struct {
@@ -33,3 +36,195 @@ func TestApplyStyles(t *testing.T) {
 		})
 	}
 }
+
+func TestPaletteStyles(t *testing.T) {
+	for n := 0; n <= 255; n++ {
+		for _, style := range []Style{ColorStyle(uint8(n)), BgStyle(uint8(n))} {
+			seq := style.ToSequence()
+			if seq == SequenceUnknown {
+				t.Fatalf("%q.ToSequence() = SequenceUnknown", style)
+			}
+			if got := seq.ToStyle(); got != style {
+				t.Errorf("%q.ToStyle() = %q, want %q", seq, got, style)
+			}
+		}
+	}
+
+	tests := []struct {
+		style Style
+		want  Sequence
+	}{
+		{"Color(208)", "\033[38;5;208m"},
+		{"Bg(22)", "\033[48;5;22m"},
+		{"COLOR( 7 )", "\033[38;5;7m"},
+		{"Color(256)", SequenceUnknown},
+		{"Color(-1)", SequenceUnknown},
+		{"Color(red)", SequenceUnknown},
+		{"Color(208", SequenceUnknown},
+		{"color(208)", SequenceUnknown},
+	}
+	for _, tt := range tests {
+		if got := tt.style.ToSequence(); got != tt.want {
+			t.Errorf("%q.ToSequence() = %q, want %q", tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestTruecolorStyles(t *testing.T) {
+	tests := []struct {
+		style     Style
+		want      Sequence
+		wantStyle Style
+	}{
+		{"#ff8800", "\033[38;2;255;136;0m", "#ff8800"},
+		{"#FF8800", "\033[38;2;255;136;0m", "#ff8800"},
+		{"#f80", "\033[38;2;255;136;0m", "#ff8800"},
+		{"rgb(255,136,0)", "\033[38;2;255;136;0m", "#ff8800"},
+		{"rgb( 255, 136, 0 )", "\033[38;2;255;136;0m", "#ff8800"},
+		{"bg:#202020", "\033[48;2;32;32;32m", "bg:#202020"},
+		{"bg:rgb(32,32,32)", "\033[48;2;32;32;32m", "bg:#202020"},
+		{"#ff880", SequenceUnknown, StyleUnknown},
+		{"#gg8800", SequenceUnknown, StyleUnknown},
+		{"rgb(256,0,0)", SequenceUnknown, StyleUnknown},
+		{"rgb(1,2)", SequenceUnknown, StyleUnknown},
+		{"bg:", SequenceUnknown, StyleUnknown},
+	}
+	for _, tt := range tests {
+		got := tt.style.ToSequence()
+		if got != tt.want {
+			t.Errorf("%q.ToSequence() = %q, want %q", tt.style, got, tt.want)
+		}
+		if style := got.ToStyle(); style != tt.wantStyle {
+			t.Errorf("%q.ToStyle() = %q, want %q", got, style, tt.wantStyle)
+		}
+	}
+
+	if got, want := RGBStyle(1, 2, 3), Style("#010203"); got != want {
+		t.Errorf("RGBStyle(1, 2, 3) = %q, want %q", got, want)
+	}
+	if got, want := BgRGBStyle(1, 2, 3), Style("bg:#010203"); got != want {
+		t.Errorf("BgRGBStyle(1, 2, 3) = %q, want %q", got, want)
+	}
+}
+
+func TestApplyStylesStrict(t *testing.T) {
+	got, err := ApplyStylesStrict("Red", "Bold")
+	if err != nil || got != "\033[31m\033[1m" {
+		t.Errorf("ApplyStylesStrict(Red, Bold) = %q, %v, want %q, nil", got, err, "\033[31m\033[1m")
+	}
+
+	_, err = ApplyStylesStrict("Red", "Blod")
+	unknown, ok := err.(*UnknownStyleError)
+	if !ok {
+		t.Fatalf("ApplyStylesStrict(Red, Blod) error = %v, want *UnknownStyleError", err)
+	}
+	want := UnknownStyleError{Name: "Blod", Pos: Position{Offset: 4, Line: 1, Column: 5}, Suggestion: "Bold"}
+	if *unknown != want {
+		t.Errorf("ApplyStylesStrict(Red, Blod) error = %+v, want %+v", *unknown, want)
+	}
+}
+
+func TestSuggestStyle(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Gren", "Green"},
+		{"bold", "Bold"},
+		{"BgRedd", "BgRed"},
+		{"BrightBlu", "BrightBlue"},
+		{"Rd", "Red"},
+		{"Sparkle", ""},
+		{"X", ""},
+	}
+	for _, tt := range tests {
+		if got := suggestStyle(tt.name); got != tt.want {
+			t.Errorf("suggestStyle(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestStyleTableSync tests that styleToSequence and sequenceToStyle agree
+// with styleTable, and that lookups match as Style.Matches does.
+func TestStyleTableSync(t *testing.T) {
+	seen := make(map[Sequence]bool)
+	for _, e := range styleTable {
+		if seen[e.seq] {
+			t.Errorf("sequence %q listed twice", e.seq)
+		}
+		seen[e.seq] = true
+		if got := styleToSequence(e.style); got != e.seq {
+			t.Errorf("styleToSequence(%q) = %q, want %q", e.style, got, e.seq)
+		}
+		if got := sequenceToStyle(e.seq); got != e.style {
+			t.Errorf("sequenceToStyle(%q) = %q, want %q", e.seq, got, e.style)
+		}
+		if len(e.style) > maxStyleLen {
+			t.Errorf("style %q is longer than maxStyleLen", e.style)
+		}
+	}
+	if got, want := len(styleSequences), len(styleTable)+2; got != want {
+		t.Errorf("len(styleSequences) = %d, want %d", got, want)
+	}
+
+	names := []string{"", "unknown", "UNKNOWN", "x", "Bgbrightmagentaa"}
+	for _, e := range styleTable {
+		s := string(e.style)
+		names = append(names, s, strings.ToUpper(s), strings.ToLower(s), s[:1]+strings.ToUpper(s[1:]), s+" ")
+	}
+	for _, name := range names {
+		if got, want := styleToSequence(Style(name)), linearStyleToSequence(Style(name)); got != want {
+			t.Errorf("styleToSequence(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// linearStyleToSequence looks up a named style by scanning styleTable with
+// Style.Matches.
+func linearStyleToSequence(s Style) Sequence {
+	for _, e := range styleTable {
+		if e.style.Matches(string(s)) {
+			return e.seq
+		}
+	}
+	switch {
+	case StyleUnknown.Matches(string(s)):
+		return SequenceUnknown
+	case StyleUnset.Matches(string(s)):
+		return SequenceUnset
+	}
+	return SequenceUnknown
+}
+
+// benchStyles are looked up by the style table benchmarks, favoring the later
+// entries a linear scan reaches last.
+var benchStyles = []Style{"Reset", "bold", "BrightRed", "BgBrightWhite", "BGBRIGHTCYAN", "Gren"}
+
+func BenchmarkStyleToSequence(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, s := range benchStyles {
+			styleToSequence(s)
+		}
+	}
+}
+
+func BenchmarkStyleToSequenceLinear(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, s := range benchStyles {
+			linearStyleToSequence(s)
+		}
+	}
+}
+
+func BenchmarkSequenceToStyle(b *testing.B) {
+	seqs := make([]Sequence, len(benchStyles))
+	for i, s := range benchStyles {
+		seqs[i] = styleToSequence(s)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range seqs {
+			sequenceToStyle(s)
+		}
+	}
+}
@@ -1,177 +1,667 @@
 package chimp
 
 import (
-	"fmt"
+	"bytes"
 	"io"
 	"strings"
+	"sync"
 )
 
 // Chimp processes text incrementally, applying ANSI styles with nesting.
+// Styles are opened by tags such as [[Red]] or [[Bold,Underline]] and closed
+// by [[end]], or by a named close such as [[/Red]] that also closes any tags
+// opened after the matching [[Red]]. [[reset]] and [[endall]], in any case,
+// close every open tag; the Reset style applies only in a list such as
+// [[Reset,Red]]. Tags may also name the aliases of a Theme; see WithTheme.
+// A literal "[[" is written as "[[[[", and a literal "[" that must not join
+// with the next bracket as "[[[]]"; see Escape. The same markup can be
+// rendered as HTML instead; see NewHTML. For rendering single strings, see
+// Render and Sprintf.
 type Chimp struct {
-	writer     io.Writer
-	styles     []string
-	lastStyles []string
-	state      string
+	writer    io.Writer
+	render    renderer
+	styles    []string
+	stylesPos []Position // where each entry of styles was opened
+	partial   []byte     // incomplete style tag carried over to the next Write
+	joined    []byte     // partial followed by the input of the current Write
+	pos       Position
+	stats     Stats
+	profile   ColorProfile
+	strict    bool
+	endPolicy EndPolicy
+	warn      func(error)
+	theme     *Theme
+	tags      map[string]*styleTag // resolved tags by text
 }
 
-// New creates a new Chimp with the given writer.
-func New(w io.Writer) *Chimp {
-	return &Chimp{
+// renderer produces output for parsed markup.
+type renderer interface {
+	// restyle is called whenever the styles stack changes. Output for the
+	// change may be deferred until the next content or flush.
+	restyle(styles []string) error
+	// content writes text in the current styles.
+	content(p []byte) error
+	// flush writes any output deferred by restyle.
+	flush() error
+	// fork returns a renderer for c sharing the output state of this one.
+	fork(c *Chimp) renderer
+}
+
+// Stats holds cumulative counters describing the work done by a Chimp.
+type Stats struct {
+	OutputBytes int // Bytes written to the underlying writer
+	Sequences   int // ANSI escape sequences emitted
+	Tags        int // Style tags processed
+}
+
+// Option configures a Chimp.
+type Option func(*Chimp)
+
+// WithColorProfile sets the color depth of the output. Colors the profile
+// cannot represent are converted to the nearest color it can. The default is
+// ProfileTrueColor.
+func WithColorProfile(p ColorProfile) Option {
+	return func(c *Chimp) {
+		c.profile = p
+	}
+}
+
+// WithStrict makes Write reject tags that would otherwise be ignored: unknown
+// styles cause an *UnknownStyleError and color styles with bad arguments an
+// *InvalidColorError. It also applies WithUnmatchedEnd(EndError), which a
+// later option may override. The rejected tag is not consumed.
+func WithStrict() Option {
+	return func(c *Chimp) {
+		c.strict = true
+		c.endPolicy = EndError
+	}
+}
+
+// EndPolicy controls how a Chimp handles closing tags that match no open
+// style: an [[end]] with no style open, or a named close such as [[/Red]]
+// with no matching [[Red]] open.
+type EndPolicy int
+
+// End policies.
+const (
+	EndIgnore EndPolicy = iota // Skip the tag
+	EndWarn                    // Skip the tag and report it to the warning handler
+	EndError                   // Reject the tag with an *UnmatchedEndError
+)
+
+// WithUnmatchedEnd sets the policy for closing tags that match no open style.
+// The default is EndIgnore.
+func WithUnmatchedEnd(p EndPolicy) Option {
+	return func(c *Chimp) {
+		c.endPolicy = p
+	}
+}
+
+// WithWarningHandler sets the function receiving problems that are reported
+// but not returned as errors, such as unmatched closing tags under EndWarn.
+func WithWarningHandler(fn func(error)) Option {
+	return func(c *Chimp) {
+		c.warn = fn
+	}
+}
+
+// New creates a new Chimp with the given writer and options.
+func New(w io.Writer, opts ...Option) *Chimp {
+	c := &Chimp{
 		writer: w,
-		state:  "normal",
+		pos:    Position{Line: 1, Column: 1},
+	}
+	c.render = &ansiRenderer{c: c, out: &ansiOutput{}}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
+}
+
+// Fork returns a new Chimp, a session, writing to the same underlying writer
+// with the same options. Each session has its own styles stack, partial tag,
+// position and stats, so producers writing interleaved markup cannot disturb
+// each other's styles: whenever output switches to another session, the
+// styles of that session are re-established. A Chimp and its forks may be used
+// from different goroutines, provided each is used by one at a time.
+func (c *Chimp) Fork() *Chimp {
+	f := &Chimp{
+		writer:    c.writer,
+		pos:       Position{Line: 1, Column: 1},
+		profile:   c.profile,
+		strict:    c.strict,
+		endPolicy: c.endPolicy,
+		warn:      c.warn,
+		theme:     c.theme,
+	}
+	f.render = c.render.fork(f)
+	return f
+}
+
+// Stats returns the counters accumulated since the Chimp was created.
+func (c *Chimp) Stats() Stats {
+	return c.stats
 }
 
 // Write processes input bytes, updating state and writing styled output.
-// It returns the number of bytes successfully written to the underlying writer.
-func (c *Chimp) Write(data []byte) (n int, err error) {
-	written := 0
+// A style tag split across calls is buffered until its remainder arrives, so
+// any chunking of the same input produces identical output. A "[[" with no
+// "]]" in the next 256 bytes is written as text. Each run of
+// content between tags reaches the underlying writer in a single call.
+// Style changes are written just before the next content, so adjacent tags
+// share one sequence, and closing the last open tag writes a reset at once.
+// It returns the number of input bytes consumed, as required by io.Writer;
+// use Stats for the number of bytes written to the underlying writer.
+func (c *Chimp) Write(p []byte) (n int, err error) {
+	data, carried := p, len(c.partial)
+	if carried > 0 {
+		c.joined = append(append(c.joined[:0], c.partial...), p...)
+		data = c.joined
+		c.partial = c.partial[:0]
+	}
+
 	for i := 0; i < len(data); {
-		if i+1 < len(data) && data[i] == '[' && data[i+1] == '[' {
-			advance, n, err := handleStyleTag(c.writer, data[i:], &c.styles, &c.lastStyles)
-			if err != nil {
-				return written, err
+		if data[i] == '[' && (i+1 == len(data) || data[i+1] == '[') {
+			literal, advance, more := bracketLiteral(data[i:])
+			if more {
+				c.partial = append(c.partial[:0], data[i:]...)
+				break
 			}
-			written += n
-			i += advance
-			if c.state == "normal" {
-				c.state = "content"
+			if advance > 0 {
+				if err := c.render.content(data[i : i+literal]); err != nil {
+					return c.consumed(data, i, carried), err
+				}
+				c.pos.advance(data[i : i+advance])
+				i += advance
+				continue
 			}
-		} else {
-			if c.state == "content" && !stylesTextsMatch(c.styles, c.lastStyles) {
-				n, err := applyStyleChanges(c.writer, c.styles, &c.lastStyles)
-				if err != nil {
-					return written, err
+
+			advance, err := c.handleStyleTag(data[i:])
+			if advance == 0 && err == nil && len(data)-i >= maxTagLen {
+				if err := c.render.content(data[i : i+2]); err != nil {
+					return c.consumed(data, i, carried), err
+				}
+				c.pos.advance(data[i : i+2])
+				i += 2
+				continue
+			}
+			if advance == 0 && err == nil {
+				c.partial = append(c.partial[:0], data[i:]...)
+				if debugging {
+					dbg("Buffering partial tag: %q\n", c.partial)
 				}
-				written += n
+				break
+			}
+			if advance > 0 {
+				if len(c.styles) > len(c.stylesPos) {
+					c.stylesPos = append(c.stylesPos, c.pos)
+				} else {
+					c.stylesPos = c.stylesPos[:len(c.styles)]
+				}
+				c.pos.advance(data[i : i+advance])
+				i += advance
 			}
-			n, err := c.writer.Write([]byte{data[i]})
 			if err != nil {
-				return written, err
+				return c.consumed(data, i, carried), err
+			}
+		} else {
+			end := contentEnd(data, i+1)
+			if err := c.render.content(data[i:end]); err != nil {
+				return c.consumed(data, i, carried), err
 			}
-			written += n
-			i++
+			c.pos.advance(data[i:end])
+			i = end
 		}
 	}
-	return written, nil
+	return len(p), nil
 }
 
-// handleStyleTag parses a style tag and applies changes, returning bytes advanced and written.
-func handleStyleTag(w io.Writer, data []byte, styles, lastStyles *[]string) (advance, n int, err error) {
-	newStyles, advance, continueParsing, err := splitStyles(data, *styles)
-	if err != nil {
-		return 0, 0, err
+// consumed converts an index into data, which starts with carried bytes left
+// over from a previous Write, into a count of bytes consumed from the current
+// input. Carried bytes not yet processed are kept for the next Write.
+func (c *Chimp) consumed(data []byte, i, carried int) int {
+	if i < carried {
+		c.partial = append(c.partial[:0], data[i:carried]...)
+		return 0
+	}
+	return i - carried
+}
+
+// Flush ends the current markup stream. Any buffered partial tag is written as
+// plain text, a reset is emitted if the terminal is still styled, and the style
+// stack is cleared so the Chimp can be reused. If tags were left open, an
+// *UnclosedTagError describing them is returned.
+func (c *Chimp) Flush() error {
+	var unclosed []UnclosedTag
+	for i, style := range c.styles {
+		unclosed = append(unclosed, UnclosedTag{Text: style, Pos: c.stylesPos[i]})
+	}
+
+	if len(c.partial) > 1 {
+		unclosed = append(unclosed, UnclosedTag{Text: string(c.partial), Pos: c.pos, Incomplete: true})
+	}
+	if err := c.finish(); err != nil {
+		return err
 	}
-	*styles = newStyles
-	if !continueParsing {
-		n, err := applyStyleChanges(w, *styles, lastStyles)
-		if err != nil {
-			return advance, 0, err
+
+	if len(unclosed) > 0 {
+		return &UnclosedTagError{Tags: unclosed}
+	}
+	return nil
+}
+
+// finish writes any buffered partial tag as plain text and closes all open
+// styles, as Flush does, without reporting them.
+func (c *Chimp) finish() error {
+	if len(c.partial) > 0 {
+		partial := c.partial
+		c.partial = c.partial[:0]
+		c.pos.advance(partial)
+		if err := c.render.content(partial); err != nil {
+			return err
 		}
-		return advance, n, nil
 	}
-	return advance, 0, nil
+
+	c.styles = c.styles[:0]
+	c.stylesPos = c.stylesPos[:0]
+	if err := c.render.restyle(c.styles); err != nil {
+		return err
+	}
+	return c.render.flush()
 }
 
-// applyStyleChanges writes styles or resets if changed, updating lastStyles.
-func applyStyleChanges(w io.Writer, styles []string, lastStyles *[]string) (n int, err error) {
-	if !stylesTextsMatch(styles, *lastStyles) {
-		s := joinStylesTexts(styles)
-		if s != "" {
-			dbg("Writing styles: %q\n", s)
-			n, err = w.Write([]byte(s))
-			if err != nil {
-				return 0, err
-			}
-			*lastStyles = append([]string(nil), styles...)
-			return n, nil
-		} else if len(*lastStyles) > 0 {
-			n, err = w.Write([]byte("\033[0m"))
-			if err != nil {
-				return 0, err
+// Close flushes the Chimp, implementing io.Closer. The underlying writer is
+// not closed.
+func (c *Chimp) Close() error {
+	return c.Flush()
+}
+
+// contentEnd returns the index of the first '[' in data at or after i that may
+// start a tag, because it is followed by another '[' or ends data, or
+// len(data) if there is none. Content up to it is written in a single call.
+func contentEnd(data []byte, i int) int {
+	for {
+		j := bytes.IndexByte(data[i:], '[')
+		if j < 0 {
+			return len(data)
+		}
+		i += j
+		if i+1 == len(data) || data[i+1] == '[' {
+			return i
+		}
+		i++
+	}
+}
+
+// bracketLiteral interprets a run of brackets at the start of data. An escaped
+// "[[[[" yields a literal "[[" and an escaped "[[[]]" a literal "[". Otherwise
+// the first bracket of "[[[" is literal so that a tag can directly follow a
+// "[". It returns the number of literal bytes and of bytes consumed, which is
+// zero if data may begin a tag, and whether more data is needed to decide.
+func bracketLiteral(data []byte) (literal, advance int, more bool) {
+	if len(data) < 3 || data[0] != '[' || data[1] != '[' || data[2] != '[' {
+		return 0, 0, false
+	}
+	switch {
+	case len(data) == 3:
+		return 0, 0, true
+	case data[3] == '[':
+		return 2, 4, false
+	case data[3] != ']':
+		return 1, 1, false
+	case len(data) == 4:
+		return 0, 0, true
+	case data[4] == ']':
+		return 1, 5, false
+	}
+	return 1, 1, false
+}
+
+// Escape returns s with every "[[" doubled to "[[[[", which markup renders as
+// a literal "[[", so that arbitrary text can be placed between style tags. A
+// trailing single "[" is written as "[[[]]", a literal "[" that cannot join
+// with a bracket following s. Escaped values can therefore be placed next to
+// each other as well as next to tags.
+func Escape(s string) string {
+	s = strings.ReplaceAll(s, "[[", "[[[[")
+	if (len(s)-len(strings.TrimRight(s, "[")))%2 == 1 {
+		s = s[:len(s)-1] + "[[[]]"
+	}
+	return s
+}
+
+// handleStyleTag parses a style tag and applies changes, returning bytes advanced.
+// A tag that updated the styles stack is reported as advanced even if writing
+// its sequences fails.
+func (c *Chimp) handleStyleTag(data []byte) (advance int, err error) {
+	text, advance, complete := scanTag(data)
+	if !complete {
+		return 0, nil
+	}
+	tag, ok := c.tags[string(text)]
+	if !ok {
+		tag = c.resolveTag(string(text))
+	}
+
+	newStyles, matched := updateStyles(c.styles, tag.text)
+	if !matched && c.endPolicy != EndIgnore {
+		unmatched := unmatchedEnd(c.styles, tag.text)
+		unmatched.Pos = c.pos
+		switch c.endPolicy {
+		case EndError:
+			return 0, unmatched
+		case EndWarn:
+			if c.warn != nil {
+				c.warn(unmatched)
 			}
-			*lastStyles = nil
-			return n, nil
 		}
 	}
-	return 0, nil
+	if c.strict && tag.unknown && len(newStyles) > len(c.styles) {
+		if err := validateStyles(tag.text, c.pos, c.theme); err != nil {
+			return 0, err
+		}
+	}
+	c.styles = newStyles
+	c.stats.Tags++
+	return advance, c.render.restyle(newStyles)
+}
+
+// styleTag is the resolved form of a style tag's text. A Chimp caches the tags
+// it sees, so that the styles stack holds one shared string per distinct tag
+// and repeated tags are resolved only once.
+type styleTag struct {
+	text    string // Tag contents
+	params  []int  // SGR parameters of the tag's styles, with aliases resolved
+	unknown bool   // Set if any style is unrecognized
+}
+
+// maxCachedTags bounds the number of distinct tags a Chimp caches, in case
+// tags are generated from unbounded data such as arbitrary colors.
+const maxCachedTags = 1024
+
+// resolveTag resolves the styles of a tag's text and caches the result.
+func (c *Chimp) resolveTag(text string) *styleTag {
+	tag := &styleTag{text: text}
+	for _, style := range c.theme.expand(text) {
+		seq := style.ToSequence()
+		if seq == SequenceUnknown {
+			tag.unknown = true
+		}
+		if params, ok := sequenceParams(seq); ok {
+			tag.params = append(tag.params, params...)
+		}
+	}
+	if c.tags == nil {
+		c.tags = make(map[string]*styleTag)
+	}
+	if len(c.tags) < maxCachedTags {
+		c.tags[text] = tag
+	}
+	return tag
 }
 
-// splitStyles updates the styles stack based on parsed input.
-func splitStyles(data []byte, styles []string) (newStyles []string, advance int, continueParsing bool, err error) {
-	parsed, advance, continueParsing, err := parseStyle(data)
-	if err != nil {
-		return nil, 0, true, err
+// tagParams returns the SGR parameters of the tag with the given text.
+func (c *Chimp) tagParams(text string) []int {
+	if tag, ok := c.tags[text]; ok {
+		return tag.params
 	}
-	if !continueParsing {
-		if parsed == "end" {
-			if len(styles) > 0 {
-				newStyles = styles[:len(styles)-1]
-			} else {
-				newStyles = styles
+	return c.resolveTag(text).params
+}
+
+// write writes p to the underlying writer, counting output bytes.
+func (c *Chimp) write(p []byte) error {
+	n, err := c.writer.Write(p)
+	c.stats.OutputBytes += n
+	return err
+}
+
+// ansiRenderer renders markup as ANSI SGR sequences.
+type ansiRenderer struct {
+	c      *Chimp
+	out    *ansiOutput // shared with the renderers of forks
+	target sgrState    // rendition described by the styles stack
+	params []int       // reused for transition parameters
+	buf    []byte      // reused for the rendered sequence
+}
+
+// ansiOutput is the state of an underlying writer shared by a Chimp and its
+// forks.
+type ansiOutput struct {
+	mu   sync.Mutex
+	term sgrState // rendition last written to the underlying writer
+}
+
+// restyle updates the target rendition. It is applied when content is next
+// written, so that adjacent tags produce a single sequence. Emptying the
+// styles stack writes any held-back change followed by the reset at once, so
+// that a Write closing all its tags leaves the terminal reset.
+func (r *ansiRenderer) restyle(styles []string) error {
+	if len(styles) == 0 {
+		r.out.mu.Lock()
+		defer r.out.mu.Unlock()
+		if err := r.applyStyleChanges(); err != nil {
+			return err
+		}
+		r.target = sgrState{}
+		return r.applyStyleChanges()
+	}
+
+	var st sgrState
+	for _, style := range styles {
+		st.apply(r.c.tagParams(style))
+	}
+	r.target = r.c.profile.convert(st)
+	return nil
+}
+
+// flush applies the target rendition.
+func (r *ansiRenderer) flush() error {
+	r.out.mu.Lock()
+	defer r.out.mu.Unlock()
+	return r.applyStyleChanges()
+}
+
+// content writes p, first applying the target rendition, which may have been
+// changed by tags or, on the shared terminal, by another session.
+func (r *ansiRenderer) content(p []byte) error {
+	r.out.mu.Lock()
+	defer r.out.mu.Unlock()
+	if err := r.applyStyleChanges(); err != nil {
+		return err
+	}
+	return r.c.write(p)
+}
+
+// fork returns a renderer for c sharing the terminal rendition.
+func (r *ansiRenderer) fork(c *Chimp) renderer {
+	return &ansiRenderer{c: c, out: r.out}
+}
+
+// applyStyleChanges writes the single SGR sequence moving the terminal to the
+// target rendition, if they differ, and records the new terminal rendition.
+// r.out.mu must be held.
+func (r *ansiRenderer) applyStyleChanges() error {
+	r.params = transition(r.params[:0], r.out.term, r.target)
+	if len(r.params) == 0 {
+		return nil
+	}
+	r.buf = appendSGR(r.buf[:0], r.params)
+	if debugging {
+		dbg("Writing styles: %q\n", r.buf)
+	}
+	if err := r.c.write(r.buf); err != nil {
+		return err
+	}
+	r.c.stats.Sequences++
+	r.out.term = r.target
+	return nil
+}
+
+// updateStyles applies a parsed tag to the styles stack. A named close such as
+// [[/Bold]] pops back through the innermost matching open tag, and [[reset]]
+// or [[endall]], in any case, clears the stack. A closing tag with no matching open style
+// leaves the stack unchanged and is reported as not matched.
+func updateStyles(styles []string, parsed string) (newStyles []string, matched bool) {
+	switch {
+	case strings.EqualFold(parsed, "reset"), strings.EqualFold(parsed, "endall"):
+		styles = styles[:0]
+	case parsed == "end", strings.HasPrefix(parsed, "/"):
+		depth := len(styles) - 1
+		if parsed != "end" {
+			for depth >= 0 && !stylesTextsEqual(parsed[1:], styles[depth]) {
+				depth--
 			}
-			dbg("After [[end]], styles: %v\n", newStyles)
-		} else {
-			newStyles = append(styles, parsed)
-			dbg("Processing style: %q\n", parsed)
 		}
+		if depth < 0 {
+			return styles, false
+		}
+		styles = styles[:depth]
+	default:
+		styles = append(styles, parsed)
 	}
-	return newStyles, advance, continueParsing, nil
+	if debugging {
+		dbg("After [[%s]], styles: %v\n", parsed, styles)
+	}
+	return styles, true
 }
 
-// parseStyle extracts a style or end marker from input data.
-func parseStyle(data []byte) (style string, advance int, continueParsing bool, err error) {
-	if len(data) < 2 || data[0] != '[' || data[1] != '[' {
-		return "", 0, true, nil
+// unmatchedEnd returns the error, without a position, for a closing tag that
+// matches none of styles.
+func unmatchedEnd(styles []string, parsed string) *UnmatchedEndError {
+	err := &UnmatchedEndError{Tag: parsed}
+	if len(styles) > 0 {
+		err.Open = styles[len(styles)-1]
 	}
+	return err
+}
+
+// maxTagLen bounds the length of a style tag, including its brackets. A "[["
+// not closed within it is text, so that unterminated brackets in ordinary
+// input are neither buffered nor rescanned without limit.
+const maxTagLen = 256
 
-	var buffer strings.Builder
-	i := 2 // Skip [[
-	for ; i < len(data); i++ {
+// scanTag returns the text of the style tag at the start of data, without
+// copying it, and the bytes it spans. complete is false if data does not
+// start with "[[", more data is needed, or no tag ends within maxTagLen bytes.
+func scanTag(data []byte) (text []byte, advance int, complete bool) {
+	if len(data) < 2 || data[0] != '[' || data[1] != '[' {
+		return nil, 0, false
+	}
+	for i := 2; i < len(data) && i+1 < maxTagLen; i++ { // Skip [[
 		if i+1 < len(data) && data[i] == ']' && data[i+1] == ']' {
-			return buffer.String(), i + 2, false, nil // Include ]]
+			return data[2:i], i + 2, true // Include ]]
+		}
+	}
+	return nil, 0, false // Need more data
+}
+
+// stylesState returns the rendition produced by applying a stack of styles,
+// resolving the aliases of theme, which may be nil. Unknown styles are ignored.
+func stylesState(styles []string, theme *Theme) sgrState {
+	var st sgrState
+	for _, styleText := range styles {
+		for _, style := range theme.expand(styleText) {
+			if params, ok := sequenceParams(style.ToSequence()); ok {
+				st.apply(params)
+			}
 		}
-		if i+5 <= len(data) && string(data[i:i+5]) == "end]]" {
-			return "end", i + 5, false, nil // Include [[end]]
+	}
+	return st
+}
+
+// validateStyles returns an *InvalidColorError or *UnknownStyleError for the
+// first unrecognized style in the text of a tag opened at pos. Aliases of
+// theme, which may be nil, are checked through the styles they stand for, and
+// their errors are reported at the alias.
+func validateStyles(text string, pos Position, theme *Theme) error {
+	offset := len("[[")
+	for _, part := range splitStyleList(text) {
+		name := strings.TrimSpace(part)
+		namePos := pos
+		namePos.advance([]byte("[[" + text)[:offset+strings.Index(part, name)])
+		styles, ok := theme.alias(name)
+		if !ok {
+			styles = []Style{Style(name)}
 		}
-		if i == len(data)-1 {
-			return "", 0, true, fmt.Errorf("unclosed style tag")
+		for _, style := range styles {
+			if err := styleError(string(style), namePos); err != nil {
+				return err
+			}
 		}
-		buffer.WriteByte(data[i])
+		offset += len(part) + len(",")
 	}
-	return "", 0, true, nil // Need more data
+	return nil
 }
 
-// joinStylesTexts combines a slice of styles into a single ANSI string.
-func joinStylesTexts(styles []string) string {
-	var ansi strings.Builder
-	for _, style := range styles {
-		ansi.WriteString(stylesTextToSequencesText(style))
+// styleError returns an *InvalidColorError or *UnknownStyleError if name,
+// found at pos, is not a recognized style.
+func styleError(name string, pos Position) error {
+	if Style(name).ToSequence() != SequenceUnknown {
+		return nil
+	}
+	if arg, ok := colorArgs(name); ok {
+		return &InvalidColorError{Style: name, Arg: arg, Pos: pos}
 	}
-	return ansi.String()
+	return &UnknownStyleError{Name: name, Pos: pos, Suggestion: suggestStyle(name)}
 }
 
-// stylesTextToSequencesText converts a comma-separated style string into ANSI escape sequences.
-func stylesTextToSequencesText(styles string) string {
-	ansi := ""
-	for _, style := range strings.Split(styles, ",") {
-		trimmed := strings.TrimSpace(style)
-		if seq := Style(trimmed).ToSequence(); seq != SequenceUnknown {
-			ansi += string(seq)
+// splitStyleList splits a comma-separated style list, leaving commas inside
+// parentheses, as in "rgb(255,136,0)", intact.
+func splitStyleList(text string) []string {
+	var list []string
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				list = append(list, text[start:i])
+				start = i + 1
+			}
 		}
 	}
-	return ansi
+	return append(list, text[start:])
 }
 
-// stylesTextsMatch compares two style slices for equality.
-func stylesTextsMatch(a, b []string) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
+// stylesTextsEqual reports whether two tag texts list the same styles,
+// ignoring case and spacing.
+func stylesTextsEqual(a, b string) bool {
+	for i, j := 0, 0; ; {
+		var x, y string
+		x, i = nextStyle(a, i)
+		y, j = nextStyle(b, j)
+		if !strings.EqualFold(x, y) {
 			return false
 		}
+		if i < 0 || j < 0 {
+			return i == j
+		}
+	}
+}
+
+// nextStyle returns the trimmed style starting at offset i of a
+// comma-separated style list, split as by splitStyleList, and the offset of the
+// following style, or -1 after the last.
+func nextStyle(text string, i int) (style string, next int) {
+	depth := 0
+	for j := i; j < len(text); j++ {
+		switch text[j] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				return strings.TrimSpace(text[i:j]), j + 1
+			}
+		}
 	}
-	return true
+	return strings.TrimSpace(text[i:]), -1
 }
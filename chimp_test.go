@@ -1,9 +1,14 @@
 package chimp
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -22,22 +27,71 @@ func TestWriteEdgeCases(t *testing.T) {
 			name:    "Incomplete tag at end",
 			input:   "[[Red",
 			want:    "",
-			wantN:   0,
-			wantErr: true,
+			wantN:   len("[[Red"),
+			wantErr: false,
 		},
 		{
 			name:    "Rapid style switches",
 			input:   "[[Red]][[end]][[Bold]]text[[end]]",
 			want:    "\033[31m\033[0m\033[1mtext\033[0m",
-			wantN:   len("\033[31m\033[0m\033[1mtext\033[0m"), // 4 + 2 + 4 + 4 + 2 = 16
+			wantN:   len("[[Red]][[end]][[Bold]]text[[end]]"),
+			wantErr: false,
+		},
+		{
+			name:    "Combined parameters",
+			input:   "[[Red]]a[[Bold, Underline]]b[[end]]c[[end]]",
+			want:    "\033[31ma\033[1;4mb\033[0;31mc\033[0m",
+			wantN:   len("[[Red]]a[[Bold, Underline]]b[[end]]c[[end]]"),
+			wantErr: false,
+		},
+		{
+			name:    "Palette colors",
+			input:   "[[Color(208),Bg(22)]]a[[Bg(52)]]b[[end]][[end]]",
+			want:    "\033[38;5;208;48;5;22ma\033[48;5;52mb\033[48;5;22m\033[0m",
+			wantN:   len("[[Color(208),Bg(22)]]a[[Bg(52)]]b[[end]][[end]]"),
+			wantErr: false,
+		},
+		{
+			name:    "Truecolor",
+			input:   "[[#ff8800, bg:rgb(32,32,32)]]a[[end]]",
+			want:    "\033[38;2;255;136;0;48;2;32;32;32ma\033[0m",
+			wantN:   len("[[#ff8800, bg:rgb(32,32,32)]]a[[end]]"),
+			wantErr: false,
+		},
+		{
+			name:    "Escaped brackets",
+			input:   "a[[[[b]] [[[Red]]c[[end]][[[[[d",
+			want:    "a[[b]] [\033[31mc\033[0m[[[d",
+			wantN:   len("a[[[[b]] [[[Red]]c[[end]][[[[[d"),
+			wantErr: false,
+		},
+		{
+			name:    "Named close",
+			input:   "[[Red]]a[[Bold]][[Underline]]b[[/bold]]c[[end]]",
+			want:    "\033[31ma\033[1;4mb\033[0;31mc\033[0m",
+			wantN:   len("[[Red]]a[[Bold]][[Underline]]b[[/bold]]c[[end]]"),
+			wantErr: false,
+		},
+		{
+			name:    "Close all",
+			input:   "[[Red]]a[[Blue]]b[[reset]]c[[Bold]]d[[endall]]e[[endall]]",
+			want:    "\033[31ma\033[34mb\033[0mc\033[1md\033[0me",
+			wantN:   len("[[Red]]a[[Blue]]b[[reset]]c[[Bold]]d[[endall]]e[[endall]]"),
+			wantErr: false,
+		},
+		{
+			name:    "Close all in any case",
+			input:   "[[Red]]a[[Reset]]b[[end]][[Blue]]c[[ENDALL]]d",
+			want:    "\033[31ma\033[0mb\033[34mc\033[0md",
+			wantN:   len("[[Red]]a[[Reset]]b[[end]][[Blue]]c[[ENDALL]]d"),
 			wantErr: false,
 		},
 		{
 			name:    "Nested with incomplete inner",
 			input:   "[[Red]][[Bold",
-			want:    "\033[31m",
-			wantN:   len("\033[31m"), // 4
-			wantErr: true,
+			want:    "",
+			wantN:   len("[[Red]][[Bold"),
+			wantErr: false,
 		},
 	}
 
@@ -50,7 +104,7 @@ func TestWriteEdgeCases(t *testing.T) {
 				t.Errorf("Write() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if n != tt.wantN {
-				t.Errorf("Write() wrote %d bytes, want %d", n, tt.wantN)
+				t.Errorf("Write() consumed %d bytes, want %d", n, tt.wantN)
 			}
 			got := buf.String()
 			if got != tt.want {
@@ -63,13 +117,16 @@ func TestWriteEdgeCases(t *testing.T) {
 // TestWriterFailure tests Surface scope with a failing writer.
 func TestWriterFailure(t *testing.T) {
 	c := New(failingWriter{})
-	_, err := c.Write([]byte("[[Red]]text"))
+	n, err := c.Write([]byte("[[Red]]text"))
 	if err == nil {
 		t.Errorf("Write() with failing writer should return an error")
 	}
 	if !errors.Is(err, io.ErrClosedPipe) {
 		t.Errorf("Write() error = %v, want %v", err, io.ErrClosedPipe)
 	}
+	if want := len("[[Red]]"); n != want {
+		t.Errorf("Write() consumed %d bytes, want %d", n, want)
+	}
 }
 
 // failingWriter always fails with io.ErrClosedPipe.
@@ -79,16 +136,16 @@ func (failingWriter) Write(p []byte) (n int, err error) {
 	return 0, io.ErrClosedPipe
 }
 
-// TestSplitStyles tests Unit scope for splitStyles.
-func TestSplitStyles(t *testing.T) {
+// TestScanTag tests Unit scope for scanTag and updateStyles.
+func TestScanTag(t *testing.T) {
 	tests := []struct {
 		name         string
 		data         []byte
 		styles       []string
 		wantStyles   []string
 		wantAdvance  int
-		wantContinue bool
-		wantErr      bool
+		wantComplete bool
+		wantMatched  bool
 	}{
 		{
 			name:         "New style",
@@ -96,8 +153,8 @@ func TestSplitStyles(t *testing.T) {
 			styles:       []string{},
 			wantStyles:   []string{"Bold"},
 			wantAdvance:  8,
-			wantContinue: false,
-			wantErr:      false,
+			wantComplete: true,
+			wantMatched:  true,
 		},
 		{
 			name:         "End style",
@@ -105,35 +162,778 @@ func TestSplitStyles(t *testing.T) {
 			styles:       []string{"Red"},
 			wantStyles:   []string{},
 			wantAdvance:  7,
-			wantContinue: false,
-			wantErr:      false,
+			wantComplete: true,
+			wantMatched:  true,
+		},
+		{
+			name:         "Unmatched end",
+			data:         []byte("[[/Bold]]"),
+			styles:       []string{"Red"},
+			wantStyles:   []string{"Red"},
+			wantAdvance:  9,
+			wantComplete: true,
+			wantMatched:  false,
 		},
 		{
 			name:         "Incomplete tag",
 			data:         []byte("[[Red"),
 			styles:       []string{},
-			wantStyles:   nil,
 			wantAdvance:  0,
-			wantContinue: true,
-			wantErr:      true,
+			wantComplete: false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			newStyles, advance, continueParsing, err := splitStyles(tt.data, tt.styles)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("splitStyles() error = %v, wantErr %v", err, tt.wantErr)
-			}
+			text, advance, complete := scanTag(tt.data)
 			if advance != tt.wantAdvance {
-				t.Errorf("splitStyles() advance = %d, want %d", advance, tt.wantAdvance)
+				t.Errorf("scanTag() advance = %d, want %d", advance, tt.wantAdvance)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("scanTag() complete = %v, want %v", complete, tt.wantComplete)
+			}
+			if !complete {
+				return
 			}
-			if continueParsing != tt.wantContinue {
-				t.Errorf("splitStyles() continueParsing = %v, want %v", continueParsing, tt.wantContinue)
+			newStyles, matched := updateStyles(tt.styles, string(text))
+			if matched != tt.wantMatched {
+				t.Errorf("updateStyles() matched = %v, want %v", matched, tt.wantMatched)
 			}
 			if !stylesTextsMatch(newStyles, tt.wantStyles) {
-				t.Errorf("splitStyles() styles = %v, want %v", newStyles, tt.wantStyles)
+				t.Errorf("updateStyles() styles = %v, want %v", newStyles, tt.wantStyles)
+			}
+		})
+	}
+}
+
+// stylesTextsMatch compares two style slices for equality.
+func stylesTextsMatch(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestWriteChunked tests Surface scope output stability across Write chunking.
+func TestWriteChunked(t *testing.T) {
+	inputs := []string{
+		"plain text",
+		"[[Red]]text[[end]]",
+		"[[Red]]a[[Bold]]b[[end]]c[[end]]d",
+		"[[Red, Bold]]x[[end]] [[Green]]y[[end]]",
+		"[[Redend]]x",
+		"a[b]c]]d[",
+		"[[Red]][[end]][[Bold]]text[[end]]",
+		"[[Red]][[Bold",
+		"a[[[[b[[[Red]]x[[end]][[[[[",
+	}
+
+	for _, input := range inputs {
+		want := writeChunks(t, []byte(input), len(input))
+		for size := 1; size < len(input); size++ {
+			if got := writeChunks(t, []byte(input), size); got != want {
+				t.Errorf("Write(%q) in chunks of %d wrote %q, want %q", input, size, got, want)
+			}
+		}
+		for split := 1; split < len(input); split++ {
+			var buf bytes.Buffer
+			c := New(&buf)
+			if _, err := c.Write([]byte(input[:split])); err != nil {
+				t.Fatalf("Write(%q) error = %v", input[:split], err)
+			}
+			if _, err := c.Write([]byte(input[split:])); err != nil {
+				t.Fatalf("Write(%q) error = %v", input[split:], err)
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("Write(%q) split at %d wrote %q, want %q", input, split, got, want)
+			}
+		}
+	}
+}
+
+// FuzzWriteChunked checks that arbitrary input splits produce identical output.
+func FuzzWriteChunked(f *testing.F) {
+	f.Add([]byte("[[Red]]a[[Bold]]b[[end]]c[[end]]"), 3)
+	f.Add([]byte("[[[x]]]][[end]][["), 1)
+	f.Fuzz(func(t *testing.T, data []byte, size int) {
+		if size <= 0 || size > len(data) {
+			return
+		}
+		if got, want := writeChunks(t, data, size), writeChunks(t, data, len(data)); got != want {
+			t.Errorf("Write(%q) in chunks of %d wrote %q, want %q", data, size, got, want)
+		}
+	})
+}
+
+// writeChunks writes data to a new Chimp in chunks of size and returns the output.
+func writeChunks(t *testing.T, data []byte, size int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	c := New(&buf)
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := c.Write(data[:n]); err != nil {
+			t.Fatalf("Write(%q) error = %v", data[:n], err)
+		}
+		data = data[n:]
+	}
+	return buf.String()
+}
+
+// TestWriteUnterminatedTag tests Surface scope handling of a "[[" never
+// closed, written in small chunks.
+func TestWriteUnterminatedTag(t *testing.T) {
+	input := "see [[ here " + strings.Repeat("long text ", 1<<15)
+	var buf bytes.Buffer
+	c := New(&buf)
+	for data := []byte(input); len(data) > 0; {
+		n := 16
+		if n > len(data) {
+			n = len(data)
+		}
+		p := data[:n]
+		data = data[n:]
+		if _, err := c.Write(p); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if len(c.partial) >= maxTagLen {
+			t.Fatalf("Write() buffered %d bytes, want fewer than %d", len(c.partial), maxTagLen)
+		}
+	}
+	if got := buf.String(); got != input {
+		t.Errorf("Write() wrote %d bytes, want the %d bytes of input unchanged", len(got), len(input))
+	}
+
+	pad := strings.Repeat(" ", maxTagLen-len("[[Red]]"))
+	for _, tt := range []struct{ input, want string }{
+		{"[[" + pad + "Red]]x", "\033[31mx"},
+		{"[[ " + pad + "Red]]x", "[[ " + pad + "Red]]x"},
+	} {
+		if got := writeChunks(t, []byte(tt.input), 7); got != tt.want {
+			t.Errorf("Write() of a %d byte tag wrote %q, want %q", len(tt.input)-1, got, tt.want)
+		}
+	}
+}
+
+// TestFlush tests Surface scope stream finalization for Chimp.Flush.
+func TestFlush(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     string
+		wantTags []UnclosedTag
+	}{
+		{
+			name:  "Balanced",
+			input: "[[Red]]text[[end]]",
+			want:  "\033[31mtext\033[0m",
+		},
+		{
+			name:  "Trailing bracket",
+			input: "text[",
+			want:  "text[",
+		},
+		{
+			name:  "Open style",
+			input: "[[Red]]text",
+			want:  "\033[31mtext\033[0m",
+			wantTags: []UnclosedTag{
+				{Text: "Red", Pos: Position{Offset: 0, Line: 1, Column: 1}},
+			},
+		},
+		{
+			name:  "Open style after named close",
+			input: "[[Red]]a[[Bold]][[Blue]]b[[/Bold]][[Green]]c",
+			want:  "\033[31ma\033[1;34mb\033[0;32mc\033[0m",
+			wantTags: []UnclosedTag{
+				{Text: "Red", Pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{Text: "Green", Pos: Position{Offset: 34, Line: 1, Column: 35}},
+			},
+		},
+		{
+			name:  "Nested open styles and partial tag",
+			input: "[[Red]]a\n[[Bold]]b[[Bo",
+			want:  "\033[31ma\n\033[1mb[[Bo\033[0m",
+			wantTags: []UnclosedTag{
+				{Text: "Red", Pos: Position{Offset: 0, Line: 1, Column: 1}},
+				{Text: "Bold", Pos: Position{Offset: 9, Line: 2, Column: 1}},
+				{Text: "[[Bo", Pos: Position{Offset: 18, Line: 2, Column: 10}, Incomplete: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := New(&buf)
+			if _, err := c.Write([]byte(tt.input)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			err := c.Flush()
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Flush() after %q wrote %q, want %q", tt.input, got, tt.want)
+			}
+			if tt.wantTags == nil {
+				if err != nil {
+					t.Errorf("Flush() error = %v, want nil", err)
+				}
+				return
+			}
+			var unclosed *UnclosedTagError
+			if !errors.As(err, &unclosed) {
+				t.Fatalf("Flush() error = %v, want *UnclosedTagError", err)
+			}
+			if !reflect.DeepEqual(unclosed.Tags, tt.wantTags) {
+				t.Errorf("Flush() tags = %+v, want %+v", unclosed.Tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+// TestClose tests Surface scope reuse of a Chimp after Close.
+func TestClose(t *testing.T) {
+	var buf bytes.Buffer
+	var wc io.WriteCloser = New(&buf)
+	if _, err := wc.Write([]byte("[[Red]]a")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := wc.Close(); err == nil {
+		t.Errorf("Close() error = nil, want unclosed tag error")
+	}
+	if _, err := wc.Write([]byte("b")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		t.Errorf("Close() error = %v, want nil", err)
+	}
+	if got, want := buf.String(), "\033[31ma\033[0mb"; got != want {
+		t.Errorf("Close() wrote %q, want %q", got, want)
+	}
+}
+
+// TestWriteBuffered tests Surface scope use of Chimp behind standard writer wrappers.
+func TestWriteBuffered(t *testing.T) {
+	input := strings.Repeat("[[Red]]error[[end]]: [[Bold]]details[[end]]\n", 20)
+	want := strings.Repeat("\033[31merror\033[0m: \033[1mdetails\033[0m\n", 20)
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriterSize(New(&buf), 16)
+	if _, err := io.Copy(bw, strings.NewReader(input)); err != nil {
+		t.Fatalf("io.Copy() error = %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("io.Copy() wrote %q, want %q", got, want)
+	}
+}
+
+// TestStats tests Surface scope counters reported by Chimp.Stats.
+func TestStats(t *testing.T) {
+	var buf bytes.Buffer
+	c := New(&buf)
+	input := "[[Red]]a[[Bold]]b[[end]][[end]]"
+	n, err := c.Write([]byte(input))
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if n != len(input) {
+		t.Errorf("Write() consumed %d bytes, want %d", n, len(input))
+	}
+
+	want := Stats{OutputBytes: buf.Len(), Sequences: 4, Tags: 4}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+// logCorpus returns markup resembling colored application logs.
+func logCorpus() []byte {
+	lines := []string{
+		"[[Faint]]2024-05-01T12:00:00Z[[end]] [[Bold,Green]]INFO[[end]] [[Cyan]]server[[end]]: listening on [[Underline]]:8080[[end]]\n",
+		"[[Faint]]2024-05-01T12:00:01Z[[end]] [[Bold,Blue]]DEBUG[[end]] [[Cyan]]http[[end]]: [[Bold]]GET[[end]] [[Underline]]/api/v1/items[[end]] took [[Yellow]]12ms[[end]]\n",
+		"[[Faint]]2024-05-01T12:00:02Z[[end]] [[Bold,Yellow]]WARN[[end]] [[Cyan]]db[[end]]: slow query [[Italic]]SELECT * FROM items[[end]]\n",
+		"[[Faint]]2024-05-01T12:00:03Z[[end]] [[Red]][[Bold]]ERROR[[end]] [[Cyan]]http[[end]]: failed to open [[Underline]]/var/data[[end]]: [[Bold]]permission denied[[end]][[end]]\n",
+	}
+	var corpus []byte
+	for i := 0; i < 50; i++ {
+		for _, line := range lines {
+			corpus = append(corpus, line...)
+		}
+	}
+	return corpus
+}
+
+// naiveOutputLen returns the output size of re-emitting the whole styles stack
+// on every change, as a baseline for BenchmarkWriteLogCorpus.
+func naiveOutputLen(data []byte) int {
+	var styles []string
+	n := 0
+	for i := 0; i < len(data); {
+		if i+1 < len(data) && data[i] == '[' && data[i+1] == '[' {
+			text, advance, _ := scanTag(data[i:])
+			styles, _ = updateStyles(styles, string(text))
+			if s := ApplyStyles(strings.Split(strings.Join(styles, ","), ",")...); s != "" {
+				n += len(s)
+			} else {
+				n += len(SequenceReset)
+			}
+			i += advance
+			continue
+		}
+		n++
+		i++
+	}
+	return n
+}
+
+// BenchmarkWriteLogCorpus reports output size against re-emitting the full stack.
+func BenchmarkWriteLogCorpus(b *testing.B) {
+	corpus := logCorpus()
+	var buf bytes.Buffer
+	b.SetBytes(int64(len(corpus)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if _, err := New(&buf).Write(corpus); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(buf.Len()), "out-bytes")
+	b.ReportMetric(float64(naiveOutputLen(corpus)), "naive-bytes")
+}
+
+// countingWriter records the size of each Write call.
+type countingWriter struct {
+	writes []int
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	w.writes = append(w.writes, len(p))
+	return len(p), nil
+}
+
+// TestWriteBatchesContent tests Surface scope that each run of content reaches
+// the underlying writer in a single call.
+func TestWriteBatchesContent(t *testing.T) {
+	var w countingWriter
+	if _, err := New(&w).Write([]byte("plain [text] [[Red]]red a[b[[[[c[[end]]done[")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// "plain [text] ", "\033[31m", "red a[b", "[[", "c", "\033[0m", "done"
+	want := []int{13, 5, 7, 2, 1, 4, 4}
+	if !reflect.DeepEqual(w.writes, want) {
+		t.Errorf("Write() made writes of %v bytes, want %v", w.writes, want)
+	}
+}
+
+// BenchmarkWriteFile measures throughput to an unbuffered file, such as
+// os.Stdout, when the whole corpus is written at once.
+func BenchmarkWriteFile(b *testing.B) {
+	benchmarkWriteFile(b, false)
+}
+
+// BenchmarkWriteFileBytewise is the baseline for BenchmarkWriteFile. It
+// writes the same corpus in one call through the previous write path, which
+// passed content to the renderer one byte at a time, so that each content
+// byte cost a system call.
+func BenchmarkWriteFileBytewise(b *testing.B) {
+	benchmarkWriteFile(b, true)
+}
+
+func benchmarkWriteFile(b *testing.B, bytewise bool) {
+	f, err := os.CreateTemp(b.TempDir(), "chimp")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	corpus := logCorpus()
+	b.SetBytes(int64(len(corpus)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := New(f)
+		if bytewise {
+			c.render = bytewiseRenderer{c.render}
+		}
+		if _, err := c.Write(corpus); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// bytewiseRenderer restores the per-byte content writes Chimp.Write made
+// before content runs were batched.
+type bytewiseRenderer struct {
+	renderer
+}
+
+func (r bytewiseRenderer) content(p []byte) error {
+	for i := range p {
+		if err := r.renderer.content(p[i : i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestWriteAllocs tests Surface scope that steady-state Write does not
+// allocate once the tags it sees have been resolved.
+func TestWriteAllocs(t *testing.T) {
+	theme, err := NewTheme(map[string][]Style{"error": {StyleBold, StyleBrightRed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts []Option
+		line string
+		rest string // written after line, splitting a tag between the two
+	}{
+		{
+			name: "Log line",
+			line: "[[Faint]]2024-05-01T12:00:03Z[[end]] [[Red]][[Bold]]ERROR[[end]] [[Cyan]]http[[end]]: denied[[end]]\n",
+		},
+		{
+			name: "Extended colors",
+			opts: []Option{WithColorProfile(ProfileANSI16)},
+			line: "[[Color(208), bg:#202020]]a[[rgb(1,2,3)]]b[[/rgb(1,2,3)]]c[[end]]\n",
+		},
+		{
+			name: "Strict theme",
+			opts: []Option{WithTheme(theme), WithStrict()},
+			line: "[[error]]failed:[[Underline]] [[[[x]][[endall]] ok\n",
+		},
+		{
+			name: "Unmatched end",
+			line: "text[[end]][[Bold]]b[[/Red]][[reset]]\n",
+		},
+		{
+			name: "Split tag",
+			line: "x[[Re",
+			rest: "d]]y[[end]] [[[",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(io.Discard, tt.opts...)
+			line, rest := []byte(tt.line), []byte(tt.rest)
+			write := func() {
+				for _, p := range [][]byte{line, rest} {
+					if _, err := c.Write(p); err != nil {
+						t.Fatalf("Write() error = %v", err)
+					}
+				}
+			}
+			write()
+			allocs := testing.AllocsPerRun(100, write)
+			if allocs != 0 {
+				t.Errorf("Write() allocated %v times per call, want 0", allocs)
+			}
+		})
+	}
+}
+
+// TestWriteUncachedTags tests Surface scope rendering once the tag cache is
+// full.
+func TestWriteUncachedTags(t *testing.T) {
+	var in, want strings.Builder
+	for i := 0; i < maxCachedTags+10; i++ {
+		fmt.Fprintf(&in, "[[#%06x]]x[[end]]", i)
+		fmt.Fprintf(&want, "\033[38;2;%d;%d;%dmx\033[0m", i>>16, i>>8&0xff, i&0xff)
+	}
+	var buf bytes.Buffer
+	c := New(&buf)
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		if _, err := c.Write([]byte(in.String())); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if got := buf.String(); got != want.String() {
+			t.Errorf("Write() pass %d output differs from the expected colors", i)
+		}
+	}
+}
+
+// TestFork tests Surface scope switching between sessions sharing a writer.
+func TestFork(t *testing.T) {
+	tests := []struct {
+		name  string
+		newFn func(io.Writer) *Chimp
+		want  string
+	}{
+		{
+			name:  "ANSI",
+			newFn: func(w io.Writer) *Chimp { return New(w) },
+			want:  "\033[31ma\033[1mb\033[0;34mc\033[1;31md\033[22m\033[0m\033[34me\033[0mf",
+		},
+		{
+			name:  "HTML",
+			newFn: func(w io.Writer) *Chimp { return NewHTML(w) },
+			want: `<span style="color:#cd0000">a<span style="font-weight:bold">b</span></span>` +
+				`<span style="color:#0000ee">c</span>` +
+				`<span style="color:#cd0000"><span style="font-weight:bold">d</span></span>` +
+				`<span style="color:#0000ee">e</span>f`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			a := tt.newFn(&buf)
+			b := a.Fork()
+			steps := []struct {
+				c    *Chimp
+				text string
+			}{
+				{a, "[[Red]]a[[Bold]]b"},
+				{b, "[[Blue]]c"},
+				{a, "d[[end]][[end]]"},
+				{b, "e[[end]]"},
+				{a, "f"},
+			}
+			for _, step := range steps {
+				if _, err := step.c.Write([]byte(step.text)); err != nil {
+					t.Fatalf("Write(%q) error = %v", step.text, err)
+				}
+			}
+			for _, c := range []*Chimp{a, b} {
+				if err := c.Flush(); err != nil {
+					t.Errorf("Flush() error = %v", err)
+				}
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("sessions wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestForkConcurrent tests Surface scope that sessions written from different
+// goroutines keep their own styles. Run it with -race.
+func TestForkConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	root := New(&buf)
+	sessions := map[byte]string{'r': "Red", 'g': "Bold,Green", 'b': "bg:#0000ff"}
+
+	done := make(chan error)
+	for ch, style := range sessions {
+		c := root.Fork()
+		go func(ch byte, style string) {
+			var err error
+			for i := 0; i < 100 && err == nil; i++ {
+				_, err = fmt.Fprintf(c, "[[%s]]%s[[end]]", style, strings.Repeat(string(ch), 1+i%5))
+			}
+			done <- err
+		}(ch, style)
+	}
+	for range sessions {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var st sgrState
+	out := buf.String()
+	for i := 0; i < len(out); i++ {
+		if out[i] == '\033' {
+			end := i + strings.IndexByte(out[i:], 'm')
+			params, _ := sequenceParams(Sequence(out[i : end+1]))
+			st.apply(params)
+			i = end
+			continue
+		}
+		if want := stylesState([]string{sessions[out[i]]}, nil); st != want {
+			t.Fatalf("byte %d (%q) rendered as %+v, want %+v", i, out[i], st, want)
+		}
+	}
+}
+
+// TestEscape tests Surface scope rendering of escaped text.
+func TestEscape(t *testing.T) {
+	for _, s := range []string{"", "plain", "[[0 1] [2 3]]", "[[[x]]]", "a[", "[[", "[[[[[", "[[end]]", "[", "[[[]]", "x[[[]]"} {
+		var buf bytes.Buffer
+		c := New(&buf)
+		if _, err := c.Write([]byte(Escape(s) + "[[Red]]x[[end]]" + Escape(s))); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if err := c.Flush(); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+		if got, want := buf.String(), s+"\033[31mx\033[0m"+s; got != want {
+			t.Errorf("Escape(%q) rendered as %q, want %q", s, got, want)
+		}
+	}
+
+	for _, pair := range [][2]string{{"x[", "[Red]]"}, {"[", "[end]]"}, {"[[[", "[["}, {"a[", "[[Red]]"}} {
+		var buf bytes.Buffer
+		c := New(&buf)
+		for _, p := range []string{Escape(pair[0]), Escape(pair[1]), "[[Red]]x[[end]]"} {
+			if _, err := c.Write([]byte(p)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		if got, want := buf.String(), pair[0]+pair[1]+"\033[31mx\033[0m"; got != want {
+			t.Errorf("Escape(%q) + Escape(%q) rendered as %q, want %q", pair[0], pair[1], got, want)
+		}
+	}
+}
+
+// TestWriteStrict tests Surface scope rejection of unknown styles in strict mode.
+func TestWriteStrict(t *testing.T) {
+	input := "ok [[Red]]x[[end]]\n[[Bold, Gren]]y[[end]]"
+	var buf bytes.Buffer
+	c := New(&buf, WithStrict())
+	n, err := c.Write([]byte(input))
+
+	var unknown *UnknownStyleError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("Write() error = %v, want *UnknownStyleError", err)
+	}
+	want := UnknownStyleError{
+		Name:       "Gren",
+		Pos:        Position{Offset: 27, Line: 2, Column: 9},
+		Suggestion: "Green",
+	}
+	if *unknown != want {
+		t.Errorf("Write() error = %+v, want %+v", *unknown, want)
+	}
+	if got, want := err.Error(), `unknown style "Gren" at 2:9; did you mean "Green"?`; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if want := strings.Index(input, "[[Bold"); n != want {
+		t.Errorf("Write() consumed %d bytes, want %d", n, want)
+	}
+	if got, want := buf.String(), "ok \033[31mx\033[0m\n"; got != want {
+		t.Errorf("Write() wrote %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	if _, err := New(&buf).Write([]byte(input)); err != nil {
+		t.Errorf("Write() without strict mode error = %v", err)
+	}
+}
+
+// TestWriteErrors tests Surface scope typed errors and their positions across
+// Write calls.
+func TestWriteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string
+		want   error
+	}{
+		{
+			name:   "Unknown style",
+			inputs: []string{"[[Red]]a[[end]]\n", "[[Purple]]"},
+			want:   &UnknownStyleError{Name: "Purple", Pos: Position{Offset: 18, Line: 2, Column: 3}},
+		},
+		{
+			name:   "Invalid palette index",
+			inputs: []string{"[[Red]]a\n[[Bo", "ld, Color(300)]]"},
+			want:   &InvalidColorError{Style: "Color(300)", Arg: "300", Pos: Position{Offset: 17, Line: 2, Column: 9}},
+		},
+		{
+			name:   "Invalid hex color",
+			inputs: []string{"x", "[[bg:#ggg]]"},
+			want:   &InvalidColorError{Style: "bg:#ggg", Arg: "ggg", Pos: Position{Offset: 3, Line: 1, Column: 4}},
+		},
+		{
+			name:   "Invalid rgb color",
+			inputs: []string{"[[rgb(1,2)]]"},
+			want:   &InvalidColorError{Style: "rgb(1,2)", Arg: "1,2", Pos: Position{Offset: 2, Line: 1, Column: 3}},
+		},
+		{
+			name:   "Unmatched end",
+			inputs: []string{"[[Red]]a[[end]]\nb", "c[[e", "nd]]"},
+			want:   &UnmatchedEndError{Tag: "end", Pos: Position{Offset: 18, Line: 2, Column: 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(io.Discard, WithStrict())
+			var err error
+			for _, input := range tt.inputs {
+				if _, err = c.Write([]byte(input)); err != nil {
+					break
+				}
+			}
+			if !reflect.DeepEqual(err, tt.want) {
+				t.Fatalf("Write() error = %#v, want %#v", err, tt.want)
+			}
+			target := reflect.New(reflect.TypeOf(tt.want))
+			if !errors.As(fmt.Errorf("wrapped: %w", err), target.Interface()) {
+				t.Errorf("errors.As(%v) failed for %T", err, tt.want)
 			}
 		})
 	}
 }
+
+// TestWriteUnmatchedEnd tests Surface scope handling of closing tags that
+// match no open style under each EndPolicy.
+func TestWriteUnmatchedEnd(t *testing.T) {
+	input := "[[end]]a[[Red]]b[[/Bold]]c[[/ red ]]d"
+	tests := []struct {
+		name     string
+		policy   EndPolicy
+		want     string
+		warnings []string
+		wantErr  error
+	}{
+		{
+			name:   "Ignore",
+			policy: EndIgnore,
+			want:   "a\033[31mbc\033[0md",
+		},
+		{
+			name:   "Warn",
+			policy: EndWarn,
+			want:   "a\033[31mbc\033[0md",
+			warnings: []string{
+				`unmatched "[[end]]" at 1:1`,
+				`unmatched "[[/Bold]]" at 1:17; innermost open tag is "[[Red]]"`,
+			},
+		},
+		{
+			name:    "Error",
+			policy:  EndError,
+			want:    "",
+			wantErr: &UnmatchedEndError{Tag: "end", Pos: Position{Offset: 0, Line: 1, Column: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var warnings []string
+			c := New(&buf, WithUnmatchedEnd(tt.policy), WithWarningHandler(func(err error) {
+				warnings = append(warnings, err.Error())
+			}))
+			_, err := c.Write([]byte(input))
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("Write() error = %#v, want %#v", err, tt.wantErr)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write() wrote %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.warnings)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	_, err := New(&buf, WithStrict()).Write([]byte("[[Red, Bold]]a[[/Red]]"))
+	want := &UnmatchedEndError{Tag: "/Red", Open: "Red, Bold", Pos: Position{Offset: 14, Line: 1, Column: 15}}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("Write() with strict mode error = %#v, want %#v", err, want)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"os"
 )
 
-var dbg = func() func(string, ...any) {
-	if os.Getenv("DEBUG") == "" {
-		return func(string, ...any) {}
-	}
-	return func(format string, as ...any) {
+// debugging enables dbg output. It is set by the DEBUG environment variable.
+var debugging = os.Getenv("DEBUG") != ""
+
+// dbg prints debugging output. Hot paths check debugging before calling it, so
+// that boxing the arguments costs nothing when debugging is off.
+func dbg(format string, as ...any) {
+	if debugging {
 		fmt.Printf(format, as...)
 	}
-}()
+}
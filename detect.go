@@ -0,0 +1,95 @@
+package chimp
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Environment supplies the process state consulted when detecting a color
+// profile. Nil functions behave as if no variables are set and no writer is a
+// terminal.
+type Environment struct {
+	LookupEnv  func(key string) (string, bool)
+	IsTerminal func(w io.Writer) bool
+}
+
+// SystemEnvironment returns the Environment of the running process.
+func SystemEnvironment() Environment {
+	return Environment{
+		LookupEnv:  os.LookupEnv,
+		IsTerminal: isTerminal,
+	}
+}
+
+// DetectColorProfile returns the color profile for output written to w, based
+// on the environment of the running process.
+func DetectColorProfile(w io.Writer) ColorProfile {
+	return SystemEnvironment().DetectColorProfile(w)
+}
+
+// WithDetectedColorProfile sets the color profile detected for the writer
+// passed to New.
+func WithDetectedColorProfile() Option {
+	return func(c *Chimp) {
+		c.profile = DetectColorProfile(c.writer)
+	}
+}
+
+// DetectColorProfile returns the color profile for output written to w. The
+// following are consulted, in order of precedence:
+//   - ProfileNone, which strips all styling, is used if w is not a terminal
+//     or TERM is "dumb", unless CLICOLOR_FORCE is set to a value other than
+//     "" or "0".
+//   - NO_COLOR, when set to a non-empty value, disables colors.
+//   - CLICOLOR set to "0" disables colors unless CLICOLOR_FORCE is set.
+//   - COLORTERM set to "truecolor" or "24bit", or a TERM ending in "-direct",
+//     selects ProfileTrueColor; a TERM containing "256color" selects
+//     ProfileANSI256. Otherwise ProfileANSI16 is used.
+func (e Environment) DetectColorProfile(w io.Writer) ColorProfile {
+	term, _ := e.lookupEnv("TERM")
+	force, _ := e.lookupEnv("CLICOLOR_FORCE")
+	forced := force != "" && force != "0"
+	if !forced && (!e.isTerminal(w) || term == "dumb") {
+		return ProfileNone
+	}
+	if v, _ := e.lookupEnv("NO_COLOR"); v != "" {
+		return ProfileASCII
+	}
+	if v, ok := e.lookupEnv("CLICOLOR"); ok && v == "0" && !forced {
+		return ProfileASCII
+	}
+
+	colorTerm, _ := e.lookupEnv("COLORTERM")
+	switch {
+	case colorTerm == "truecolor", colorTerm == "24bit", strings.HasSuffix(term, "-direct"):
+		return ProfileTrueColor
+	case strings.Contains(term, "256color"):
+		return ProfileANSI256
+	}
+	return ProfileANSI16
+}
+
+// lookupEnv calls e.LookupEnv if it is set.
+func (e Environment) lookupEnv(key string) (string, bool) {
+	if e.LookupEnv == nil {
+		return "", false
+	}
+	return e.LookupEnv(key)
+}
+
+// isTerminal calls e.IsTerminal if it is set.
+func (e Environment) isTerminal(w io.Writer) bool {
+	return e.IsTerminal != nil && e.IsTerminal(w)
+}
+
+// isTerminal reports whether w is a file connected to a character device,
+// such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
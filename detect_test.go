@@ -0,0 +1,71 @@
+package chimp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestDetectColorProfile tests Unit scope for Environment.DetectColorProfile.
+func TestDetectColorProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		tty  bool
+		want ColorProfile
+	}{
+		{"Terminal", map[string]string{"TERM": "xterm"}, true, ProfileANSI16},
+		{"No TERM", nil, true, ProfileANSI16},
+		{"Not a terminal", map[string]string{"TERM": "xterm-256color"}, false, ProfileNone},
+		{"Dumb", map[string]string{"TERM": "dumb"}, true, ProfileNone},
+		{"256 colors", map[string]string{"TERM": "xterm-256color"}, true, ProfileANSI256},
+		{"Direct color TERM", map[string]string{"TERM": "xterm-direct"}, true, ProfileTrueColor},
+		{"COLORTERM truecolor", map[string]string{"TERM": "xterm", "COLORTERM": "truecolor"}, true, ProfileTrueColor},
+		{"COLORTERM 24bit", map[string]string{"COLORTERM": "24bit"}, true, ProfileTrueColor},
+		{"NO_COLOR", map[string]string{"NO_COLOR": "1", "COLORTERM": "truecolor"}, true, ProfileASCII},
+		{"Empty NO_COLOR", map[string]string{"NO_COLOR": "", "TERM": "xterm"}, true, ProfileANSI16},
+		{"NO_COLOR beats force", map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, true, ProfileASCII},
+		{"CLICOLOR off", map[string]string{"CLICOLOR": "0", "TERM": "xterm"}, true, ProfileASCII},
+		{"NO_COLOR piped", map[string]string{"NO_COLOR": "1", "TERM": "xterm"}, false, ProfileNone},
+		{"NO_COLOR dumb", map[string]string{"NO_COLOR": "1", "TERM": "dumb"}, true, ProfileNone},
+		{"CLICOLOR off piped", map[string]string{"CLICOLOR": "0", "TERM": "xterm"}, false, ProfileNone},
+		{"NO_COLOR forced piped", map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, false, ProfileASCII},
+		{"CLICOLOR on", map[string]string{"CLICOLOR": "1", "TERM": "xterm"}, true, ProfileANSI16},
+		{"Forced", map[string]string{"CLICOLOR_FORCE": "1", "TERM": "xterm-256color"}, false, ProfileANSI256},
+		{"Forced dumb", map[string]string{"CLICOLOR_FORCE": "1", "TERM": "dumb"}, false, ProfileANSI16},
+		{"Forced beats CLICOLOR", map[string]string{"CLICOLOR_FORCE": "1", "CLICOLOR": "0"}, false, ProfileANSI16},
+		{"Force disabled", map[string]string{"CLICOLOR_FORCE": "0", "TERM": "xterm"}, false, ProfileNone},
+		{"Empty force", map[string]string{"CLICOLOR_FORCE": "", "TERM": "xterm"}, false, ProfileNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := Environment{
+				LookupEnv: func(key string) (string, bool) {
+					v, ok := tt.env[key]
+					return v, ok
+				},
+				IsTerminal: func(io.Writer) bool { return tt.tty },
+			}
+			if got := env.DetectColorProfile(io.Discard); got != tt.want {
+				t.Errorf("DetectColorProfile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := (Environment{}).DetectColorProfile(io.Discard); got != ProfileNone {
+		t.Errorf("zero Environment DetectColorProfile() = %s, want %s", got, ProfileNone)
+	}
+}
+
+// TestWithDetectedColorProfile tests Surface scope detection through New.
+func TestWithDetectedColorProfile(t *testing.T) {
+	t.Setenv("CLICOLOR_FORCE", "")
+	var buf bytes.Buffer
+	c := New(&buf, WithDetectedColorProfile())
+	if _, err := c.Write([]byte("[[Red]]a[[end]]")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got, want := buf.String(), "a"; got != want {
+		t.Errorf("Write() to a buffer wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package chimp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position identifies a location in the markup stream written to a Chimp.
+// Offset counts bytes from the start of the stream; Line and Column are
+// 1-based, with Column counted in bytes.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// String returns the position formatted as "line:column".
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// advance moves the position past data.
+func (p *Position) advance(data []byte) {
+	for _, b := range data {
+		p.Offset++
+		if b == '\n' {
+			p.Line++
+			p.Column = 1
+			continue
+		}
+		p.Column++
+	}
+}
+
+// UnclosedTag describes a style tag left open at the end of a stream.
+type UnclosedTag struct {
+	Text       string   // Tag contents, or the raw bytes of an incomplete tag
+	Pos        Position // Location of the opening [[
+	Incomplete bool     // Set if the tag was never terminated by ]]
+}
+
+// UnclosedTagError reports style tags still open when a Chimp is flushed.
+type UnclosedTagError struct {
+	Tags []UnclosedTag
+}
+
+// Error implements the error interface.
+func (e *UnclosedTagError) Error() string {
+	parts := make([]string, 0, len(e.Tags))
+	for _, tag := range e.Tags {
+		if tag.Incomplete {
+			parts = append(parts, fmt.Sprintf("incomplete style tag %q at %s", tag.Text, tag.Pos))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("unclosed style tag %q at %s", "[["+tag.Text+"]]", tag.Pos))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// UnknownStyleError reports a style name that matches no known style. It is
+// returned in strict mode.
+type UnknownStyleError struct {
+	Name       string
+	Pos        Position // Location of the name
+	Suggestion string   // Closest known style name, if any is similar
+}
+
+// Error implements the error interface.
+func (e *UnknownStyleError) Error() string {
+	msg := fmt.Sprintf("unknown style %q at %s", e.Name, e.Pos)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf("; did you mean %q?", e.Suggestion)
+	}
+	return msg
+}
+
+// InvalidColorError reports a color style with a malformed or out-of-range
+// argument, such as "Color(300)" or "#ggg". It is returned in strict mode.
+type InvalidColorError struct {
+	Style string
+	Arg   string
+	Pos   Position // Location of the style
+}
+
+// Error implements the error interface.
+func (e *InvalidColorError) Error() string {
+	return fmt.Sprintf("invalid color argument %q in %q at %s", e.Arg, e.Style, e.Pos)
+}
+
+// UnmatchedEndError reports a closing tag that matches no open style: an
+// [[end]] with no style open, or a named close such as [[/Red]] with no
+// matching [[Red]] open. It is returned under EndError.
+type UnmatchedEndError struct {
+	Tag  string   // Closing tag contents, e.g. "end" or "/Red"
+	Open string   // Innermost open tag contents, if any
+	Pos  Position // Location of the tag
+}
+
+// Error implements the error interface.
+func (e *UnmatchedEndError) Error() string {
+	msg := fmt.Sprintf("unmatched %q at %s", "[["+e.Tag+"]]", e.Pos)
+	if e.Open != "" {
+		msg += fmt.Sprintf("; innermost open tag is %q", "[["+e.Open+"]]")
+	}
+	return msg
+}
+
+// ThemeCycleError reports theme aliases that refer back to themselves.
+type ThemeCycleError struct {
+	Cycle []string // Aliases in reference order, starting and ending with the same alias
+	Pos   Position // Definition closing the cycle in a theme file; zero for NewTheme
+}
+
+// Error implements the error interface.
+func (e *ThemeCycleError) Error() string {
+	msg := fmt.Sprintf("theme alias cycle: %s", strings.Join(e.Cycle, " -> "))
+	if e.Pos.Line > 0 {
+		msg += fmt.Sprintf(" at %s", e.Pos)
+	}
+	return msg
+}
+
+// ThemeSyntaxError reports a malformed theme file.
+type ThemeSyntaxError struct {
+	Msg string   // Description of the problem
+	Pos Position // Location of the problem in the file
+}
+
+// Error implements the error interface.
+func (e *ThemeSyntaxError) Error() string {
+	return fmt.Sprintf("%s at %s", e.Msg, e.Pos)
+}
+
+// ThemeLoadError reports every problem found while loading a theme file. The
+// errors are *ThemeSyntaxError, *UnknownStyleError, *InvalidColorError or
+// *ThemeCycleError values, with positions in the file.
+type ThemeLoadError struct {
+	File   string // Name of the file, if known
+	Errors []error
+}
+
+// Error implements the error interface, describing each problem on its own
+// line.
+func (e *ThemeLoadError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		lines[i] = err.Error()
+		if e.File != "" {
+			lines[i] = e.File + ": " + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors found, for use with errors.Is and errors.As on
+// Go versions that support multiple wrapped errors.
+func (e *ThemeLoadError) Unwrap() []error {
+	return e.Errors
+}
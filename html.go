@@ -0,0 +1,253 @@
+package chimp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// htmlClassPrefix prefixes the CSS class names used by WithHTMLClasses.
+const htmlClassPrefix = "chimp-"
+
+// htmlAttrs maps each text attribute to its CSS class name and declaration.
+// Attributes with a decoration share the text-decoration property.
+var htmlAttrs = []struct {
+	attr       attrs
+	class      string
+	css        string
+	decoration string
+}{
+	{attrBold, "bold", "font-weight:bold", ""},
+	{attrFaint, "faint", "opacity:0.6", ""},
+	{attrItalic, "italic", "font-style:italic", ""},
+	{attrUnderline, "underline", "", "underline"},
+	{attrBlink, "blink", "", "blink"},
+	{attrRapidBlink, "rapid-blink", "", "blink"},
+	{attrInverse, "inverse", "filter:invert(100%)", ""},
+	{attrHidden, "hidden", "visibility:hidden", ""},
+	{attrStrikethrough, "strikethrough", "", "line-through"},
+}
+
+// htmlColorNames holds the class names of the 16 standard and bright colors.
+var htmlColorNames = [16]string{
+	"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white",
+	"bright-black", "bright-red", "bright-green", "bright-yellow",
+	"bright-blue", "bright-magenta", "bright-cyan", "bright-white",
+}
+
+// htmlResetCSS overrides inherited styling for the Reset style.
+const htmlResetCSS = "font-weight:normal;font-style:normal;text-decoration:none;opacity:1;" +
+	"filter:none;visibility:visible;color:initial;background-color:initial"
+
+// NewHTML creates a Chimp that renders markup to w as HTML. Each style tag
+// becomes a <span> element with inline CSS, closed by the matching [[end]] or
+// when the Chimp is flushed, and content is HTML-escaped. Color profiles do
+// not apply to HTML output.
+func NewHTML(w io.Writer, opts ...Option) *Chimp {
+	c := New(w)
+	c.render = &htmlRenderer{c: c, out: &htmlOutput{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithHTMLClasses makes a Chimp created by NewHTML describe the 16 standard
+// colors and text attributes with CSS classes, as defined by HTMLStylesheet,
+// instead of inline styles. Palette and 24-bit colors remain inline. It has no
+// effect on other Chimps.
+func WithHTMLClasses() Option {
+	return func(c *Chimp) {
+		if r, ok := c.render.(*htmlRenderer); ok {
+			r.classes = true
+		}
+	}
+}
+
+// HTMLStylesheet returns CSS rules for the classes used by WithHTMLClasses.
+func HTMLStylesheet() string {
+	var b strings.Builder
+	for _, a := range htmlAttrs {
+		css := a.css
+		if a.decoration != "" {
+			css = "text-decoration:" + a.decoration
+		}
+		fmt.Fprintf(&b, ".%s%s{%s}\n", htmlClassPrefix, a.class, css)
+	}
+	for i, name := range htmlColorNames {
+		c := color{mode: colorBasic, index: uint8(i)}
+		fmt.Fprintf(&b, ".%s%s{color:%s}\n", htmlClassPrefix, name, c.css())
+		fmt.Fprintf(&b, ".%sbg-%s{background-color:%s}\n", htmlClassPrefix, name, c.css())
+	}
+	fmt.Fprintf(&b, ".%sreset{%s}\n", htmlClassPrefix, htmlResetCSS)
+	return b.String()
+}
+
+// htmlRenderer renders markup as nested <span> elements.
+type htmlRenderer struct {
+	c       *Chimp
+	out     *htmlOutput // shared with the renderers of forks
+	styles  []string    // style tags that should have an open <span>
+	classes bool
+}
+
+// htmlOutput is the state of an underlying writer shared by a Chimp and its
+// forks.
+type htmlOutput struct {
+	mu   sync.Mutex
+	open []string // style tags with an open <span>
+}
+
+// restyle records the new styles stack. The open spans are updated when
+// content is next written, so that tags with no content between them produce
+// no empty elements, except that emptying the stack closes them at once.
+func (r *htmlRenderer) restyle(styles []string) error {
+	r.styles = append(r.styles[:0], styles...)
+	if len(styles) > 0 {
+		return nil
+	}
+	return r.flush()
+}
+
+// syncSpans closes the open spans of tags not on the styles stack, which may
+// belong to another session, and opens spans for the rest. r.out.mu must be
+// held.
+func (r *htmlRenderer) syncSpans() error {
+	open := r.out.open
+	keep := 0
+	for keep < len(open) && keep < len(r.styles) && open[keep] == r.styles[keep] {
+		keep++
+	}
+
+	var b strings.Builder
+	for i := len(open); i > keep; i-- {
+		b.WriteString("</span>")
+	}
+	for _, style := range r.styles[keep:] {
+		r.writeOpenTag(&b, style)
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	if debugging {
+		dbg("Writing spans: %q\n", b.String())
+	}
+	if err := r.c.write([]byte(b.String())); err != nil {
+		return err
+	}
+	r.out.open = append(open[:keep], r.styles[keep:]...)
+	return nil
+}
+
+// flush updates the open spans.
+func (r *htmlRenderer) flush() error {
+	r.out.mu.Lock()
+	defer r.out.mu.Unlock()
+	return r.syncSpans()
+}
+
+// fork returns a renderer for c sharing the open spans.
+func (r *htmlRenderer) fork(c *Chimp) renderer {
+	return &htmlRenderer{c: c, out: r.out, classes: r.classes}
+}
+
+// content writes p HTML-escaped, first updating the open spans if a previous
+// attempt failed or another session changed them.
+func (r *htmlRenderer) content(p []byte) error {
+	r.out.mu.Lock()
+	defer r.out.mu.Unlock()
+	if err := r.syncSpans(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for _, ch := range p {
+		switch ch {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '"':
+			b.WriteString("&#34;")
+		case '\'':
+			b.WriteString("&#39;")
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return r.c.write([]byte(b.String()))
+}
+
+// writeOpenTag writes the opening <span> element for a style tag.
+func (r *htmlRenderer) writeOpenTag(b *strings.Builder, styleText string) {
+	var classes, decls []string
+	for _, style := range r.c.theme.expand(styleText) {
+		if style.ToSequence() == SequenceReset {
+			classes = append(classes, htmlClassPrefix+"reset")
+			decls = append(decls, htmlResetCSS)
+		}
+	}
+
+	st := stylesState([]string{styleText}, r.c.theme)
+	var decorations []string
+	for _, a := range htmlAttrs {
+		if st.attrs&a.attr == 0 {
+			continue
+		}
+		classes = append(classes, htmlClassPrefix+a.class)
+		if a.decoration != "" {
+			decorations = append(decorations, a.decoration)
+		} else {
+			decls = append(decls, a.css)
+		}
+	}
+	if len(decorations) > 0 {
+		decls = append(decls, "text-decoration:"+strings.Join(decorations, " "))
+	}
+
+	var inline []string // declarations without a class
+	for _, c := range []struct {
+		color    color
+		property string
+		class    string
+	}{
+		{st.fg, "color", ""},
+		{st.bg, "background-color", "bg-"},
+	} {
+		switch c.color.mode {
+		case colorDefault:
+			continue
+		case colorBasic:
+			classes = append(classes, htmlClassPrefix+c.class+htmlColorNames[c.color.index])
+			decls = append(decls, c.property+":"+c.color.css())
+		default:
+			inline = append(inline, c.property+":"+c.color.css())
+		}
+	}
+
+	b.WriteString("<span")
+	if r.classes {
+		if len(classes) > 0 {
+			fmt.Fprintf(b, ` class="%s"`, strings.Join(classes, " "))
+		}
+	} else {
+		inline = append(decls, inline...)
+	}
+	if len(inline) > 0 {
+		fmt.Fprintf(b, ` style="%s"`, strings.Join(inline, ";"))
+	}
+	b.WriteString(">")
+}
+
+// css returns the color as a CSS hex color, using the xterm default values
+// for palette colors.
+func (c color) css() string {
+	r, g, b := c.r, c.g, c.b
+	if c.mode == colorBasic || c.mode == color256 {
+		r, g, b = paletteRGB(c.index)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
@@ -0,0 +1,123 @@
+package chimp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestHTML tests Surface scope rendering of markup by NewHTML.
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		classes bool
+		want    string
+	}{
+		{
+			name:  "Simple",
+			input: "[[Green]]ok[[end]]",
+			want:  `<span style="color:#00cd00">ok</span>`,
+		},
+		{
+			name:  "Nested and escaped",
+			input: "[[Bold,Underline,Strikethrough]]a<b [[Bg(208)]]&\"'[[end]]>[[end]]",
+			want: `<span style="font-weight:bold;text-decoration:underline line-through">a&lt;b ` +
+				`<span style="background-color:#ff8700">&amp;&#34;&#39;</span>&gt;</span>`,
+		},
+		{
+			name:  "Bright and background",
+			input: "[[BrightRed,BgBrightBlue]]x[[end]]",
+			want:  `<span style="color:#ff0000;background-color:#5c5cff">x</span>`,
+		},
+		{
+			name:  "No empty elements",
+			input: "[[Red]][[end]][[Bold]][[Green]][[/Green]]x[[end]][[Blue]][[end]]",
+			want:  `<span style="font-weight:bold">x</span>`,
+		},
+		{
+			name:  "Unknown style",
+			input: "[[Foo]]x[[end]]",
+			want:  `<span>x</span>`,
+		},
+		{
+			name:    "Classes",
+			input:   "[[Bold,Red,#ff8800,BgCyan]]x[[end]]",
+			classes: true,
+			want:    `<span class="chimp-bold chimp-bg-cyan" style="color:#ff8800">x</span>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var opts []Option
+			if tt.classes {
+				opts = append(opts, WithHTMLClasses())
+			}
+			c := NewHTML(&buf, opts...)
+			if _, err := c.Write([]byte(tt.input)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write(%q) wrote %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHTMLFlush tests Surface scope closing of open spans by Flush.
+func TestHTMLFlush(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewHTML(&buf)
+	if _, err := c.Write([]byte("[[Red]]a[[Bold]]b<[[It")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	err := c.Flush()
+	var unclosed *UnclosedTagError
+	if !errors.As(err, &unclosed) || len(unclosed.Tags) != 3 {
+		t.Errorf("Flush() error = %v, want 3 unclosed tags", err)
+	}
+	want := `<span style="color:#cd0000">a<span style="font-weight:bold">b&lt;[[It</span></span>`
+	if got := buf.String(); got != want {
+		t.Errorf("Flush() wrote %s, want %s", got, want)
+	}
+}
+
+// TestHTMLStyles tests Surface scope CSS for every Style constant.
+func TestHTMLStyles(t *testing.T) {
+	styles := []Style{
+		StyleReset, StyleBold, StyleFaint, StyleItalic, StyleUnderline,
+		StyleBlink, StyleRapidBlink, StyleInverse, StyleHidden, StyleStrikethrough,
+		StyleBlack, StyleRed, StyleGreen, StyleYellow, StyleBlue, StyleMagenta, StyleCyan, StyleWhite,
+		StyleBgBlack, StyleBgRed, StyleBgGreen, StyleBgYellow, StyleBgBlue, StyleBgMagenta, StyleBgCyan, StyleBgWhite,
+		StyleBrightBlack, StyleBrightRed, StyleBrightGreen, StyleBrightYellow,
+		StyleBrightBlue, StyleBrightMagenta, StyleBrightCyan, StyleBrightWhite,
+		StyleBgBrightBlack, StyleBgBrightRed, StyleBgBrightGreen, StyleBgBrightYellow,
+		StyleBgBrightBlue, StyleBgBrightMagenta, StyleBgBrightCyan, StyleBgBrightWhite,
+	}
+	stylesheet := HTMLStylesheet()
+	for _, style := range styles {
+		tag := "[[" + style + "]]x"
+		if style == StyleReset {
+			tag = "[[Reset,]]x" // [[Reset]] alone closes all tags
+		}
+		var inline, classes bytes.Buffer
+		if _, err := NewHTML(&inline).Write([]byte(tag)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if _, err := NewHTML(&classes, WithHTMLClasses()).Write([]byte(tag)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if !strings.HasPrefix(inline.String(), `<span style="`) {
+			t.Errorf("%s rendered as %s, want inline style", style, inline.String())
+		}
+		class := strings.TrimSuffix(strings.TrimPrefix(classes.String(), `<span class="`), `">x`)
+		if class == classes.String() || !strings.Contains(stylesheet, "."+class+"{") {
+			t.Errorf("%s rendered as %s, want a class from HTMLStylesheet", style, classes.String())
+		}
+	}
+}
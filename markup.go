@@ -0,0 +1,225 @@
+package chimp
+
+import (
+	"io"
+	"strings"
+)
+
+// MarkupWriter converts text containing ANSI escape sequences, such as
+// captured terminal output, into chimp markup. SGR sequences, including those
+// combining several parameters, become balanced style tags; other control
+// sequences and strings, such as OSC hyperlinks, are dropped. Sequences split
+// across writes are buffered.
+type MarkupWriter struct {
+	writer  io.Writer
+	state   sgrState   // rendition selected by the input so far
+	open    []sgrState // rendition inside each open tag, outermost first
+	partial []byte     // incomplete escape sequence carried over to the next Write
+	bracket bool       // last byte written was a literal "[" that may pair with another
+}
+
+// controlStrings lists the bytes that, following an escape, begin a control
+// string: OSC, DCS, SOS, PM and APC.
+const controlStrings = "]PX^_"
+
+// maxEscapeLen bounds the bytes of an incomplete escape sequence buffered
+// between writes. The payload of a longer control string is dropped as it
+// arrives.
+const maxEscapeLen = 4096
+
+// NewMarkupWriter creates a MarkupWriter writing markup to w.
+func NewMarkupWriter(w io.Writer) *MarkupWriter {
+	return &MarkupWriter{writer: w}
+}
+
+// Write converts p to markup. It returns the number of bytes of p consumed.
+func (m *MarkupWriter) Write(p []byte) (n int, err error) {
+	data := p
+	if len(m.partial) > 0 {
+		data = append(m.partial, p...)
+		m.partial = nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(data); {
+		if data[i] != '\033' {
+			m.writeTransition(&out)
+			m.writeContent(&out, data[i])
+			i++
+			continue
+		}
+		advance, ok := m.handleEscape(data[i:])
+		if !ok {
+			rest := data[i:]
+			if len(rest) > maxEscapeLen && strings.IndexByte(controlStrings, rest[1]) >= 0 {
+				// Keep only the introducer, and an escape that may begin ST
+				kept := append([]byte(nil), rest[:2]...)
+				if rest[len(rest)-1] == '\033' {
+					kept = append(kept, '\033')
+				}
+				rest = kept
+			}
+			m.partial = append([]byte(nil), rest...)
+			break
+		}
+		i += advance
+	}
+
+	if _, err := io.WriteString(m.writer, out.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush closes all open tags and discards any incomplete escape sequence, so
+// the MarkupWriter can be reused.
+func (m *MarkupWriter) Flush() error {
+	var out strings.Builder
+	for range m.open {
+		out.WriteString("[[end]]")
+	}
+	*m = MarkupWriter{writer: m.writer}
+	_, err := io.WriteString(m.writer, out.String())
+	return err
+}
+
+// Close flushes the MarkupWriter, implementing io.Closer. The underlying
+// writer is not closed.
+func (m *MarkupWriter) Close() error {
+	return m.Flush()
+}
+
+// handleEscape interprets the escape sequence at the start of data, returning
+// the bytes it spans, or false if data ends before the sequence does.
+func (m *MarkupWriter) handleEscape(data []byte) (advance int, ok bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+	switch {
+	case data[1] == '[':
+	case strings.IndexByte(controlStrings, data[1]) >= 0:
+		return stringEnd(data)
+	default:
+		// Not a control sequence; drop the escape, any intermediate bytes
+		// and the final byte, as in "\033(B"
+		i := 1
+		for i < len(data) && data[i] >= 0x20 && data[i] <= 0x2f {
+			i++
+		}
+		if i == len(data) {
+			return 0, false
+		}
+		return i + 1, true
+	}
+	for i := 2; i < len(data); i++ {
+		b := data[i]
+		if b >= 0x20 && b <= 0x3f {
+			continue // Parameter and intermediate bytes
+		}
+		if b == 'm' {
+			if params, ok := sequenceParams(Sequence(data[:i+1])); ok {
+				m.state.apply(params)
+			}
+		}
+		return i + 1, true
+	}
+	return 0, false
+}
+
+// stringEnd returns the bytes spanned by the control string, such as an OSC
+// hyperlink or title, at the start of data, which ends at BEL or ST ("\033\\"),
+// or false if data ends before the string does. Any other escape also ends
+// the string, so that the sequence it begins is not lost.
+func stringEnd(data []byte) (advance int, ok bool) {
+	for i := 2; i < len(data); i++ {
+		switch {
+		case data[i] == '\a':
+			return i + 1, true
+		case data[i] != '\033':
+		case i+1 == len(data):
+			return 0, false
+		case data[i+1] == '\\':
+			return i + 2, true
+		default:
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// writeContent writes a content byte, escaping "[[" as "[[[[" across writes.
+func (m *MarkupWriter) writeContent(out *strings.Builder, b byte) {
+	if b != '[' {
+		out.WriteByte(b)
+		m.bracket = false
+		return
+	}
+	if m.bracket {
+		out.WriteString("[[[") // Completes "[[[[" with the previous bracket
+		m.bracket = false
+		return
+	}
+	out.WriteByte(b)
+	m.bracket = true
+}
+
+// writeTransition writes the tags moving the markup from the rendition of
+// the open tags to the current one. Tags are closed back to the innermost one
+// whose rendition is contained in the current rendition, and a tag adding
+// the remaining styles is opened.
+func (m *MarkupWriter) writeTransition(out *strings.Builder) {
+	current := sgrState{}
+	if len(m.open) > 0 {
+		current = m.open[len(m.open)-1]
+	}
+	if current == m.state {
+		return
+	}
+
+	keep := len(m.open)
+	for keep > 0 && !m.open[keep-1].within(m.state) {
+		keep--
+	}
+	m.bracket = false
+	for i := len(m.open); i > keep; i-- {
+		out.WriteString("[[end]]")
+	}
+	m.open = m.open[:keep]
+
+	base := sgrState{}
+	if keep > 0 {
+		base = m.open[keep-1]
+	}
+	if styles := stateStyles(base, m.state); len(styles) > 0 {
+		out.WriteString("[[" + strings.Join(styles, ",") + "]]")
+		m.open = append(m.open, m.state)
+	}
+}
+
+// within reports whether every attribute and color of s is also set in t.
+func (s sgrState) within(t sgrState) bool {
+	return s.attrs&^t.attrs == 0 &&
+		(s.fg.mode == colorDefault || s.fg == t.fg) &&
+		(s.bg.mode == colorDefault || s.bg == t.bg)
+}
+
+// stateStyles returns the styles that add the rendition of to on top of
+// from, which must be within to.
+func stateStyles(from, to sgrState) []string {
+	var styles []string
+	add := func(params []int) {
+		styles = append(styles, string(Sequence(renderSGR(params)).ToStyle()))
+	}
+	for _, ac := range attrCodes {
+		if to.attrs&ac.attr != 0 && from.attrs&ac.attr == 0 {
+			add([]int{ac.on})
+		}
+	}
+	if to.fg != from.fg {
+		add(to.fg.params(nil, 30))
+	}
+	if to.bg != from.bg {
+		add(to.bg.params(nil, 40))
+	}
+	return styles
+}
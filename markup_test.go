@@ -0,0 +1,128 @@
+package chimp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestMarkupWriter tests Surface scope conversion of ANSI output to markup.
+func TestMarkupWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Plain", "plain text", "plain text"},
+		{"Combined params", "\033[1;31merror\033[0m: ok", "[[Bold,Red]]error[[end]]: ok"},
+		{"Nested", "\033[31mred \033[1mbold\033[22m red\033[0m", "[[Red]]red [[Bold]]bold[[end]] red[[end]]"},
+		{"Color switch", "\033[31ma\033[32mb\033[m", "[[Red]]a[[end]][[Green]]b[[end]]"},
+		{"Extended colors", "\033[38;5;208mx\033[48;2;1;2;3my\033[0m", "[[Color(208)]]x[[bg:#010203]]y[[end]][[end]]"},
+		{"Redundant sequences", "\033[1m\033[1m\033[0m\033[31mx\033[39m", "[[Red]]x[[end]]"},
+		{"Other control sequences", "\033[2K\033[1Gline\033]", "line"},
+		{"Hyperlink", "\033]8;;http://x\033\\link\033]8;;\033\\ done", "link done"},
+		{"Window title", "\033]0;title\a\033Pdata\033\\x\033_app\033[1my\033[0m", "x[[Bold]]y[[end]]"},
+		{"Character set", "\033[1mbold\033(B\033[mplain", "[[Bold]]bold[[end]]plain"},
+		{"G1 character set", "a\033)0b\033 Fc", "abc"},
+		{"Unterminated style", "\033[4munder", "[[Underline]]under[[end]]"},
+		{"Incomplete sequence", "x\033[3", "x"},
+		{"Brackets", "\033[1m[[x]]\033[0m[[[", "[[Bold]][[[[x]][[end]][[[[["},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			m := NewMarkupWriter(&buf)
+			if n, err := m.Write([]byte(tt.input)); err != nil || n != len(tt.input) {
+				t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(tt.input))
+			}
+			if err := m.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write(%q) wrote %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMarkupWriterSplitString tests Surface scope dropping of a control
+// string split across writes.
+func TestMarkupWriterSplitString(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMarkupWriter(&buf)
+	for _, p := range []string{"a\033]8;;http:", "//x\033", "\\b\033]8;;\a", "c"} {
+		if _, err := m.Write([]byte(p)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if got, want := buf.String(), "abc"; got != want {
+		t.Errorf("split hyperlink wrote %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	writes := []string{"x\033]0;"}
+	for i := 0; i < 64; i++ {
+		writes = append(writes, strings.Repeat("payload ", 64))
+	}
+	for _, p := range append(writes, "\033", "\\y") {
+		if _, err := m.Write([]byte(p)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if len(m.partial) > maxEscapeLen {
+			t.Fatalf("Write() buffered %d bytes of an unterminated string, want at most %d", len(m.partial), maxEscapeLen)
+		}
+	}
+	if got, want := buf.String(), "xy"; got != want {
+		t.Errorf("long unterminated string wrote %q, want %q", got, want)
+	}
+}
+
+// TestMarkupWriterRoundTrip tests Surface scope re-rendering of converted
+// markup, with the input split at every offset.
+func TestMarkupWriterRoundTrip(t *testing.T) {
+	markup := "[[Red]]a[[Bold,Underline]]b[[end]]c[[BgBlue]]d[[Color(208)]]e[[end]][[end]]f[[end]]g" +
+		"[[Bold,Red]]h[[Faint]]i[[end]]j[[end]][[#ff8800]]k[[end]]l[[[[[[[Red]][[[[end]]"
+	var ansi bytes.Buffer
+	if _, err := New(&ansi).Write([]byte(markup)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	for split := 0; split <= ansi.Len(); split++ {
+		var converted bytes.Buffer
+		m := NewMarkupWriter(&converted)
+		if _, err := m.Write(ansi.Bytes()[:split]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if _, err := m.Write(ansi.Bytes()[split:]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if err := m.Flush(); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+
+		var rendered bytes.Buffer
+		c := New(&rendered)
+		if _, err := c.Write(converted.Bytes()); err != nil {
+			t.Fatalf("Write(%q) error = %v", converted.String(), err)
+		}
+		if err := c.Flush(); err != nil {
+			t.Fatalf("Flush() after %q error = %v", converted.String(), err)
+		}
+		if got, want := replaySGR(t, rendered.String()), replaySGR(t, ansi.String()); !sameStates(got, want) {
+			t.Errorf("split at %d: markup %q renders differently from %q", split, converted.String(), ansi.String())
+		}
+	}
+}
+
+// sameStates reports whether two renditions per content byte are equal.
+func sameStates(a, b map[byte]sgrState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package chimp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Render returns markup rendered with ANSI sequences, as written by a Chimp
+// created by New. Styles left open at the end are closed, and an incomplete
+// trailing tag is kept as plain text.
+func Render(markup string) string {
+	return render(markup, ProfileTrueColor)
+}
+
+// Strip returns markup with its tags removed and escaped brackets unescaped,
+// as written by a Chimp with ProfileNone.
+func Strip(markup string) string {
+	return render(markup, ProfileNone)
+}
+
+// Sprint formats its operands as fmt.Sprint does and renders the result as
+// markup, as Render does. Text from untrusted sources should be passed through
+// Escape first, so that it cannot open or close styles whatever it is placed
+// next to, other than a single "[" left unescaped in the markup itself.
+func Sprint(a ...any) string {
+	return Render(fmt.Sprint(a...))
+}
+
+// Sprintf formats according to a format specifier as fmt.Sprintf does and
+// renders the result as markup, as Render does. As with Sprint, untrusted
+// operands should be escaped.
+func Sprintf(format string, a ...any) string {
+	return Render(fmt.Sprintf(format, a...))
+}
+
+// Fprintf formats according to a format specifier as fmt.Fprintf does and
+// writes the result, rendered as markup, to w. Styles left open at the end are
+// closed. It returns the number of bytes written to w and any write error.
+// To adapt the output to w, create a Chimp with WithDetectedColorProfile
+// instead.
+func Fprintf(w io.Writer, format string, a ...any) (n int, err error) {
+	c := New(w)
+	if _, err = fmt.Fprintf(c, format, a...); err == nil {
+		err = c.finish()
+	}
+	return c.stats.OutputBytes, err
+}
+
+// render renders markup for a color profile.
+func render(markup string, p ColorProfile) string {
+	var b strings.Builder
+	c := New(&b, WithColorProfile(p))
+	c.Write([]byte(markup)) // Writing to a strings.Builder cannot fail
+	c.finish()
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package chimp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// TestRender tests Surface scope rendering and stripping of markup strings.
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name       string
+		markup     string
+		wantRender string
+		wantStrip  string
+	}{
+		{
+			name:       "Nested",
+			markup:     "[[Red]]error:[[Bold]] denied[[end]] at [[#ff8800]]x[[/#ff8800]][[end]]",
+			wantRender: "\033[31merror:\033[1m denied\033[22m at \033[38;2;255;136;0mx\033[31m\033[0m",
+			wantStrip:  "error: denied at x",
+		},
+		{
+			name:       "Unclosed",
+			markup:     "[[Green]]ok[[Bo",
+			wantRender: "\033[32mok[[Bo\033[0m",
+			wantStrip:  "ok[[Bo",
+		},
+		{
+			name:       "Close all",
+			markup:     "[[Red]]a[[RESET]]b[[end]]c",
+			wantRender: "\033[31ma\033[0mbc",
+			wantStrip:  "abc",
+		},
+		{
+			name:       "Escaped",
+			markup:     "a" + Escape("[[b]]"),
+			wantRender: "a[[b]]",
+			wantStrip:  "a[[b]]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.markup); got != tt.wantRender {
+				t.Errorf("Render(%q) = %q, want %q", tt.markup, got, tt.wantRender)
+			}
+			if got := Strip(tt.markup); got != tt.wantStrip {
+				t.Errorf("Strip(%q) = %q, want %q", tt.markup, got, tt.wantStrip)
+			}
+		})
+	}
+}
+
+// TestSprint tests Surface scope formatting helpers.
+func TestSprint(t *testing.T) {
+	if got, want := Sprint("[[Bold]]", 42, "[[end]]"), "\033[1m42\033[0m"; got != want {
+		t.Errorf("Sprint() = %q, want %q", got, want)
+	}
+	if got, want := Sprintf("[[Red]]%d files[[end]] in %s", 3, Escape("[[dir]]")), "\033[31m3 files\033[0m in [[dir]]"; got != want {
+		t.Errorf("Sprintf() = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	n, err := Fprintf(&buf, "[[Cyan]]%s", "path")
+	if want := "\033[36mpath\033[0m"; buf.String() != want || n != len(want) || err != nil {
+		t.Errorf("Fprintf() = %d, %v wrote %q, want %d, nil wrote %q", n, err, buf.String(), len(want), want)
+	}
+	if _, err := Fprintf(failingWriter{}, "[[Red]]x"); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Fprintf() with failing writer error = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
@@ -0,0 +1,115 @@
+package chimp
+
+// ColorProfile describes the color depth supported by a terminal.
+type ColorProfile int
+
+// Color profiles, from most to least capable.
+const (
+	ProfileTrueColor ColorProfile = iota // 24-bit colors
+	ProfileANSI256                       // The xterm 256-color palette
+	ProfileANSI16                        // The 16 standard and bright colors
+	ProfileASCII                         // No colors; text attributes only
+	ProfileNone                          // No escape sequences; markup is stripped
+)
+
+// String returns the name of the profile.
+func (p ColorProfile) String() string {
+	switch p {
+	case ProfileTrueColor:
+		return "TrueColor"
+	case ProfileANSI256:
+		return "ANSI256"
+	case ProfileANSI16:
+		return "ANSI16"
+	case ProfileASCII:
+		return "ASCII"
+	case ProfileNone:
+		return "None"
+	}
+	return "unknown"
+}
+
+// convert returns the state with each color replaced by the nearest color
+// representable in the profile. ProfileNone represents every state as the
+// default, so no sequences are ever emitted.
+func (p ColorProfile) convert(s sgrState) sgrState {
+	if p == ProfileNone {
+		return sgrState{}
+	}
+	s.fg = p.convertColor(s.fg)
+	s.bg = p.convertColor(s.bg)
+	return s
+}
+
+// convertColor returns the nearest color representable in the profile.
+func (p ColorProfile) convertColor(c color) color {
+	switch p {
+	case ProfileANSI256:
+		if c.mode == colorRGB {
+			return color{mode: color256, index: nearestPaletteColor(c.r, c.g, c.b, 16, 255)}
+		}
+	case ProfileANSI16:
+		switch c.mode {
+		case color256:
+			if c.index < 16 {
+				return color{mode: colorBasic, index: c.index}
+			}
+			r, g, b := paletteRGB(c.index)
+			return color{mode: colorBasic, index: nearestPaletteColor(r, g, b, 0, 15)}
+		case colorRGB:
+			return color{mode: colorBasic, index: nearestPaletteColor(c.r, c.g, c.b, 0, 15)}
+		}
+	case ProfileASCII:
+		return color{}
+	}
+	return c
+}
+
+// basicRGB holds the xterm default values of the 16 standard and bright colors.
+var basicRGB = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// cubeLevels holds the component values of the 6x6x6 color cube.
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// paletteRGB returns the xterm default value of a 256-color palette index.
+func paletteRGB(i uint8) (r, g, b uint8) {
+	switch {
+	case i < 16:
+		return basicRGB[i][0], basicRGB[i][1], basicRGB[i][2]
+	case i < 232:
+		i -= 16
+		return cubeLevels[i/36], cubeLevels[i/6%6], cubeLevels[i%6]
+	}
+	v := 8 + 10*(i-232)
+	return v, v, v
+}
+
+// nearestPaletteColor returns the palette index between lo and hi, inclusive,
+// closest to the given color. Ties resolve to the lowest index.
+func nearestPaletteColor(r, g, b uint8, lo, hi int) uint8 {
+	best, bestDist := lo, -1
+	for i := lo; i <= hi; i++ {
+		pr, pg, pb := paletteRGB(uint8(i))
+		if d := colorDistance(r, g, b, pr, pg, pb); bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return uint8(best)
+}
+
+// colorDistance returns a perceptual distance between two colors using the
+// "redmean" weighted Euclidean approximation, which accounts for the eye's
+// varying sensitivity to each component depending on the amount of red. The
+// result is the squared distance scaled by 256.
+func colorDistance(r1, g1, b1, r2, g2, b2 uint8) int {
+	rmean := (int(r1) + int(r2)) / 2
+	dr := int(r1) - int(r2)
+	dg := int(g1) - int(g2)
+	db := int(b1) - int(b2)
+	return (512+rmean)*dr*dr + 1024*dg*dg + (767-rmean)*db*db
+}
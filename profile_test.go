@@ -0,0 +1,116 @@
+package chimp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestNearestPaletteColor tests Unit scope for nearestPaletteColor.
+func TestNearestPaletteColor(t *testing.T) {
+	tests := []struct {
+		rgb      [3]uint8
+		want256  uint8
+		wantANSI uint8
+	}{
+		{[3]uint8{255, 136, 0}, 208, 3},
+		{[3]uint8{255, 0, 0}, 196, 9},
+		{[3]uint8{128, 128, 128}, 244, 8},
+		{[3]uint8{32, 32, 32}, 234, 0},
+		{[3]uint8{0, 0, 128}, 18, 4},
+		{[3]uint8{250, 250, 250}, 231, 15},
+	}
+	for _, tt := range tests {
+		r, g, b := tt.rgb[0], tt.rgb[1], tt.rgb[2]
+		if got := nearestPaletteColor(r, g, b, 16, 255); got != tt.want256 {
+			t.Errorf("nearestPaletteColor(%v, 16, 255) = %d, want %d", tt.rgb, got, tt.want256)
+		}
+		if got := nearestPaletteColor(r, g, b, 0, 15); got != tt.wantANSI {
+			t.Errorf("nearestPaletteColor(%v, 0, 15) = %d, want %d", tt.rgb, got, tt.wantANSI)
+		}
+	}
+}
+
+// TestPaletteRGB tests Unit scope for paletteRGB.
+func TestPaletteRGB(t *testing.T) {
+	for i := 0; i <= 255; i++ {
+		r, g, b := paletteRGB(uint8(i))
+		if i >= 16 && nearestPaletteColor(r, g, b, 16, 255) != uint8(i) {
+			t.Errorf("palette color %d (%d, %d, %d) is not its own nearest color", i, r, g, b)
+		}
+	}
+	if r, g, b := paletteRGB(208); r != 255 || g != 135 || b != 0 {
+		t.Errorf("paletteRGB(208) = %d, %d, %d, want 255, 135, 0", r, g, b)
+	}
+}
+
+// TestWriteColorProfile tests Surface scope color downsampling in Chimp.Write.
+func TestWriteColorProfile(t *testing.T) {
+	input := "[[#ff8800,Bold]]a[[Color(196)]]b[[Bg(2)]]c[[end]]b[[end]]a[[end]]"
+	tests := []struct {
+		profile ColorProfile
+		want    string
+	}{
+		{ProfileTrueColor, "\033[1;38;2;255;136;0ma\033[38;5;196mb\033[48;5;2mc\033[49mb\033[38;2;255;136;0ma\033[0m"},
+		{ProfileANSI256, "\033[1;38;5;208ma\033[38;5;196mb\033[48;5;2mc\033[49mb\033[38;5;208ma\033[0m"},
+		{ProfileANSI16, "\033[1;33ma\033[91mb\033[42mc\033[49mb\033[33ma\033[0m"},
+		{ProfileASCII, "\033[1mabcba\033[0m"},
+		{ProfileNone, "abcba"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			c := New(&buf, WithColorProfile(tt.profile))
+			if _, err := c.Write([]byte(input)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write() with %s wrote %q, want %q", tt.profile, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteStripMatchesStyled tests Surface scope error parity between styled
+// and stripped output.
+func TestWriteStripMatchesStyled(t *testing.T) {
+	inputs := []string{
+		"[[Red]]error[[end]]: [[Bold]]details[[end]]",
+		"[[Red]]a[[Bold]]b[[end]]",
+		"[[Red]]a\n[[Bo",
+		"[[Unknown]]a[[end]][[end]]",
+	}
+	for _, input := range inputs {
+		var styled, stripped bytes.Buffer
+		c := New(&styled)
+		s := New(&stripped, WithColorProfile(ProfileNone))
+
+		cn, cerr := c.Write([]byte(input))
+		sn, serr := s.Write([]byte(input))
+		if cn != sn || !sameError(cerr, serr) {
+			t.Errorf("Write(%q) = %d, %v stripped, want %d, %v", input, sn, serr, cn, cerr)
+		}
+		if cerr, serr := c.Flush(), s.Flush(); !sameError(cerr, serr) {
+			t.Errorf("Flush() after %q = %v stripped, want %v", input, serr, cerr)
+		}
+
+		var plain bytes.Buffer
+		for i := 0; i < styled.Len(); i++ {
+			if b := styled.Bytes()[i]; b == '\033' {
+				i += bytes.IndexByte(styled.Bytes()[i:], 'm')
+			} else {
+				plain.WriteByte(b)
+			}
+		}
+		if got, want := stripped.String(), plain.String(); got != want {
+			t.Errorf("Write(%q) stripped wrote %q, want %q", input, got, want)
+		}
+	}
+}
+
+// sameError reports whether two errors are both nil or have the same message.
+func sameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Error() == b.Error()
+}
@@ -0,0 +1,267 @@
+package chimp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// attrs is a set of SGR text attributes.
+type attrs uint16
+
+// SGR text attributes.
+const (
+	attrBold attrs = 1 << iota
+	attrFaint
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrRapidBlink
+	attrInverse
+	attrHidden
+	attrStrikethrough
+)
+
+// attrCodes lists each attribute with the SGR parameters that set and clear
+// it. Some attributes share a clearing parameter (e.g. 22 clears both bold and
+// faint), and the set parameters are 1 through 9 in order.
+var attrCodes = []struct {
+	attr    attrs
+	on, off int
+}{
+	{attrBold, 1, 22},
+	{attrFaint, 2, 22},
+	{attrItalic, 3, 23},
+	{attrUnderline, 4, 24},
+	{attrBlink, 5, 25},
+	{attrRapidBlink, 6, 25},
+	{attrInverse, 7, 27},
+	{attrHidden, 8, 28},
+	{attrStrikethrough, 9, 29},
+}
+
+// clearedBy returns the attributes cleared by the SGR parameter off.
+func clearedBy(off int) attrs {
+	var cleared attrs
+	for _, ac := range attrCodes {
+		if ac.off == off {
+			cleared |= ac.attr
+		}
+	}
+	return cleared
+}
+
+// colorMode identifies how a color is expressed.
+type colorMode uint8
+
+// Color modes.
+const (
+	colorDefault colorMode = iota // Terminal default color
+	colorBasic                    // One of the 16 standard and bright colors
+	color256                      // An index into the 256-color palette
+	colorRGB                      // A 24-bit color
+)
+
+// color is a foreground or background color. The zero value is the terminal
+// default.
+type color struct {
+	mode    colorMode
+	index   uint8 // 0-7 standard, 8-15 bright, or a 256-color palette index
+	r, g, b uint8 // Components of a 24-bit color
+}
+
+// basicColor returns the color selected by a standard or bright SGR parameter
+// relative to base (30 for foreground, 40 for background).
+func basicColor(p, base int) color {
+	if p >= base+60 {
+		return color{mode: colorBasic, index: uint8(p - base - 60 + 8)}
+	}
+	return color{mode: colorBasic, index: uint8(p - base)}
+}
+
+// params appends the SGR parameters selecting the color relative to base (30
+// for foreground, 40 for background).
+func (c color) params(dst []int, base int) []int {
+	switch c.mode {
+	case colorBasic:
+		if c.index < 8 {
+			return append(dst, base+int(c.index))
+		}
+		return append(dst, base+60+int(c.index)-8)
+	case color256:
+		return append(dst, base+8, 5, int(c.index))
+	case colorRGB:
+		return append(dst, base+8, 2, int(c.r), int(c.g), int(c.b))
+	}
+	return append(dst, base+9)
+}
+
+// sgrState is the effective rendition produced by a series of SGR sequences.
+// The zero value is the terminal default.
+type sgrState struct {
+	attrs  attrs
+	fg, bg color
+}
+
+// apply updates the state with SGR parameters. Unsupported parameters are
+// ignored.
+func (s *sgrState) apply(params []int) {
+	for i := 0; i < len(params); i++ {
+		switch p := params[i]; {
+		case p == 0:
+			*s = sgrState{}
+		case p >= 1 && p <= 9:
+			s.attrs |= attrCodes[p-1].attr
+		case p >= 22 && p <= 29:
+			s.attrs &^= clearedBy(p)
+		case p >= 30 && p <= 37, p >= 90 && p <= 97:
+			s.fg = basicColor(p, 30)
+		case p == 39:
+			s.fg = color{}
+		case p >= 40 && p <= 47, p >= 100 && p <= 107:
+			s.bg = basicColor(p, 40)
+		case p == 49:
+			s.bg = color{}
+		case p == 38, p == 48:
+			c, n, ok := extendedColor(params[i+1:])
+			if !ok {
+				return // The remaining parameters cannot be interpreted
+			}
+			if p == 38 {
+				s.fg = c
+			} else {
+				s.bg = c
+			}
+			i += n
+		}
+	}
+}
+
+// extendedColor parses the parameters following a 38 or 48 SGR parameter,
+// returning the color and the number of parameters consumed.
+func extendedColor(params []int) (c color, n int, ok bool) {
+	if len(params) >= 2 && params[0] == 5 && params[1] <= 255 {
+		return color{mode: color256, index: uint8(params[1])}, 2, true
+	}
+	if len(params) >= 4 && params[0] == 2 && params[1] <= 255 && params[2] <= 255 && params[3] <= 255 {
+		return color{mode: colorRGB, r: uint8(params[1]), g: uint8(params[2]), b: uint8(params[3])}, 4, true
+	}
+	return color{}, 0, false
+}
+
+// params appends the SGR parameters establishing the state from the default.
+func (s sgrState) params(dst []int) []int {
+	for _, ac := range attrCodes {
+		if s.attrs&ac.attr != 0 {
+			dst = append(dst, ac.on)
+		}
+	}
+	if s.fg.mode != colorDefault {
+		dst = s.fg.params(dst, 30)
+	}
+	if s.bg.mode != colorDefault {
+		dst = s.bg.params(dst, 40)
+	}
+	return dst
+}
+
+// transition appends to dst the SGR parameters that move a terminal from one
+// state to another. Both an incremental form, which clears and sets only the
+// attributes and colors that differ, and a reset followed by the full target
+// state are considered, and the shorter parameter list is appended.
+func transition(dst []int, from, to sgrState) []int {
+	if from == to {
+		return dst
+	}
+	if to == (sgrState{}) {
+		return append(dst, 0)
+	}
+
+	start := len(dst)
+	cur := from
+	for _, ac := range attrCodes {
+		if cur.attrs&ac.attr != 0 && to.attrs&ac.attr == 0 {
+			dst = append(dst, ac.off)
+			cur.attrs &^= clearedBy(ac.off)
+		}
+	}
+	for _, ac := range attrCodes {
+		if cur.attrs&ac.attr == 0 && to.attrs&ac.attr != 0 {
+			dst = append(dst, ac.on)
+		}
+	}
+	if cur.fg != to.fg {
+		dst = to.fg.params(dst, 30)
+	}
+	if cur.bg != to.bg {
+		dst = to.bg.params(dst, 40)
+	}
+
+	mid := len(dst) // The reset form follows the incremental one
+	dst = to.params(append(dst, 0))
+	if paramsLen(dst[mid:]) < paramsLen(dst[start:mid]) {
+		return append(dst[:start], dst[mid:]...)
+	}
+	return dst[:mid]
+}
+
+// paramsLen returns the rendered length of SGR parameters, excluding the
+// surrounding escape sequence.
+func paramsLen(params []int) int {
+	n := len(params) - 1 // Separators
+	for _, p := range params {
+		n++
+		for ; p >= 10; p /= 10 {
+			n++
+		}
+	}
+	return n
+}
+
+// renderSGR formats SGR parameters as a single escape sequence, or returns an
+// empty string if there are none.
+func renderSGR(params []int) string {
+	return string(appendSGR(nil, params))
+}
+
+// appendSGR appends the escape sequence formatted by renderSGR to dst.
+func appendSGR(dst []byte, params []int) []byte {
+	if len(params) == 0 {
+		return dst
+	}
+	dst = append(dst, "\033["...)
+	for i, p := range params {
+		if i > 0 {
+			dst = append(dst, ';')
+		}
+		dst = strconv.AppendInt(dst, int64(p), 10)
+	}
+	return append(dst, 'm')
+}
+
+// sequenceParams extracts the parameters of an SGR escape sequence. An empty
+// parameter list is equivalent to a reset.
+func sequenceParams(seq Sequence) ([]int, bool) {
+	s := string(seq)
+	if !strings.HasPrefix(s, "\033[") || !strings.HasSuffix(s, "m") {
+		return nil, false
+	}
+	s = s[2 : len(s)-1]
+	if s == "" {
+		return []int{0}, true
+	}
+
+	fields := strings.Split(s, ";")
+	params := make([]int, 0, len(fields))
+	for _, f := range fields {
+		if f == "" {
+			params = append(params, 0)
+			continue
+		}
+		p, err := strconv.Atoi(f)
+		if err != nil || p < 0 {
+			return nil, false
+		}
+		params = append(params, p)
+	}
+	return params, true
+}
@@ -0,0 +1,96 @@
+package chimp
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// TestTransition tests Unit scope for transition.
+func TestTransition(t *testing.T) {
+	red := color{mode: colorBasic, index: 1}
+	tests := []struct {
+		name string
+		from sgrState
+		to   sgrState
+		want string
+	}{
+		{"Unchanged", sgrState{attrs: attrBold}, sgrState{attrs: attrBold}, ""},
+		{"To default", sgrState{attrs: attrBold, fg: red}, sgrState{}, "\033[0m"},
+		{"Add bold", sgrState{fg: red}, sgrState{attrs: attrBold, fg: red}, "\033[1m"},
+		{"Drop bold", sgrState{attrs: attrBold, fg: red}, sgrState{fg: red}, "\033[22m"},
+		{"Drop bold keep faint", sgrState{attrs: attrBold | attrFaint, fg: red}, sgrState{attrs: attrFaint, fg: red}, "\033[22;2m"},
+		{"Drop color", sgrState{attrs: attrUnderline, fg: red}, sgrState{attrs: attrUnderline}, "\033[39m"},
+		{"Drop background", sgrState{attrs: attrUnderline, bg: red}, sgrState{attrs: attrUnderline}, "\033[49m"},
+		{
+			"Reset is shorter",
+			sgrState{attrs: attrBold | attrItalic | attrUnderline | attrInverse, fg: red},
+			sgrState{attrs: attrHidden},
+			"\033[0;8m",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderSGR(transition(nil, tt.from, tt.to)); got != tt.want {
+				t.Errorf("transition(%+v, %+v) = %q, want %q", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteRestoresOuterStyles tests Surface scope style restoration for every
+// pair of nested styles.
+func TestWriteRestoresOuterStyles(t *testing.T) {
+	styles := []Style{
+		StyleBold, StyleFaint, StyleItalic, StyleUnderline, StyleBlink,
+		StyleRapidBlink, StyleInverse, StyleHidden, StyleStrikethrough,
+		StyleRed, StyleBrightGreen, StyleBgBlue, StyleBgBrightYellow,
+		ColorStyle(208), BgStyle(22), RGBStyle(255, 136, 0), BgRGBStyle(32, 32, 32),
+	}
+
+	for _, outer := range styles {
+		for _, inner := range styles {
+			input := fmt.Sprintf("[[%s]]a[[%s]]b[[end]]c[[end]]d", outer, inner)
+			var buf bytes.Buffer
+			if _, err := New(&buf).Write([]byte(input)); err != nil {
+				t.Fatalf("Write(%q) error = %v", input, err)
+			}
+
+			outerState := stylesState([]string{string(outer)}, nil)
+			want := map[byte]sgrState{
+				'a': outerState,
+				'b': stylesState([]string{string(outer), string(inner)}, nil),
+				'c': outerState,
+				'd': {},
+			}
+			got := replaySGR(t, buf.String())
+			for content, state := range want {
+				if got[content] != state {
+					t.Errorf("Write(%q) rendered %q as %+v, want %+v", input, content, got[content], state)
+				}
+			}
+		}
+	}
+}
+
+// replaySGR interprets styled output as a terminal would, returning the
+// rendition in effect for each content byte.
+func replaySGR(t *testing.T, out string) map[byte]sgrState {
+	t.Helper()
+	var st sgrState
+	states := make(map[byte]sgrState)
+	for i := 0; i < len(out); i++ {
+		if out[i] != '\033' {
+			states[out[i]] = st
+			continue
+		}
+		end := i + bytes.IndexByte([]byte(out[i:]), 'm')
+		params, ok := sequenceParams(Sequence(out[i : end+1]))
+		if !ok {
+			t.Fatalf("invalid sequence %q in %q", out[i:end+1], out)
+		}
+		st.apply(params)
+		i = end
+	}
+	return states
+}
@@ -0,0 +1,54 @@
+package chimp
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// SyncChimp is a Chimp that may be shared by multiple goroutines, for example
+// around os.Stderr. Each call to Write is a self-contained message: styles
+// left open at its end are closed, a trailing partial tag is written as plain
+// text, and the rendered message reaches the underlying writer in a single
+// call while other writes wait. Styles used in one message therefore never
+// apply to another, however writes from different goroutines interleave.
+type SyncChimp struct {
+	mu     sync.Mutex
+	writer io.Writer
+	c      *Chimp
+	buf    bytes.Buffer // rendered output of the current message
+}
+
+// NewSync creates a SyncChimp with the given writer and options, which are
+// applied as by New.
+func NewSync(w io.Writer, opts ...Option) *SyncChimp {
+	s := &SyncChimp{writer: w}
+	s.c = New(w, opts...)
+	s.c.writer = &s.buf // Options such as WithDetectedColorProfile inspect w
+	return s
+}
+
+// Write renders p as a single message. It returns the number of bytes of p
+// consumed; if parsing fails, the part of the message before the error is
+// still written, with its styles closed.
+func (s *SyncChimp) Write(p []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf.Reset()
+	n, err = s.c.Write(p)
+	if ferr := s.c.finish(); err == nil {
+		err = ferr
+	}
+	if _, werr := s.writer.Write(s.buf.Bytes()); werr != nil {
+		return 0, werr
+	}
+	return n, err
+}
+
+// Stats returns the counters accumulated since the SyncChimp was created.
+func (s *SyncChimp) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c.Stats()
+}
@@ -0,0 +1,123 @@
+package chimp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestSyncChimp tests Surface scope that each Write is a self-contained
+// message.
+func TestSyncChimp(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSync(&buf)
+	for _, msg := range []string{"[[Red]]a[[Bold]]b", "c[[Bo", "[[Green]]d[[end]]\n"} {
+		if n, err := s.Write([]byte(msg)); n != len(msg) || err != nil {
+			t.Errorf("Write(%q) = %d, %v, want %d, nil", msg, n, err, len(msg))
+		}
+	}
+	want := "\033[31ma\033[1mb\033[0m" + "c[[Bo" + "\033[32md\033[0m\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Write() wrote %q, want %q", got, want)
+	}
+	if got, want := s.Stats(), (Stats{OutputBytes: len(want), Sequences: 5, Tags: 4}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	buf.Reset()
+	s = NewSync(&buf, WithStrict())
+	n, err := s.Write([]byte("[[Red]]a[[Gren]]b"))
+	if _, ok := err.(*UnknownStyleError); !ok || n != len("[[Red]]a") {
+		t.Errorf("Write() = %d, %v, want %d, *UnknownStyleError", n, err, len("[[Red]]a"))
+	}
+	if got, want := buf.String(), "\033[31ma\033[0m"; got != want {
+		t.Errorf("Write() wrote %q, want %q", got, want)
+	}
+}
+
+// recordingWriter records each Write call separately.
+type recordingWriter struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (w *recordingWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+// TestSyncChimpConcurrent tests Surface scope that concurrent messages reach
+// the underlying writer whole, without styles leaking between them. Run it
+// with -race.
+func TestSyncChimpConcurrent(t *testing.T) {
+	var w recordingWriter
+	s := NewSync(&w)
+	colors := []string{"Red", "Green", "Blue", "Yellow"}
+	const perGoroutine = 50
+
+	var wg sync.WaitGroup
+	for g, color := range colors {
+		wg.Add(1)
+		go func(g int, color string) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				// Leave the style open on odd messages
+				msg := fmt.Sprintf("[[%s]][[Bold]]%d[[end]]:%d", color, g, i)
+				if i%2 == 0 {
+					msg += "[[end]]"
+				}
+				if _, err := s.Write([]byte(msg)); err != nil {
+					t.Error(err)
+				}
+			}
+		}(g, color)
+	}
+	wg.Wait()
+
+	if got, want := len(w.writes), len(colors)*perGoroutine; got != want {
+		t.Fatalf("underlying writer received %d writes, want %d", got, want)
+	}
+	for _, out := range w.writes {
+		var g, i int
+		if _, err := fmt.Sscanf(stripSGR(out), "%d:%d", &g, &i); err != nil {
+			t.Fatalf("unexpected message %q", out)
+		}
+		var want bytes.Buffer
+		c := New(&want)
+		fmt.Fprintf(c, "[[%s]][[Bold]]%d[[end]]:%d", colors[g], g, i)
+		c.Flush()
+		if out != want.String() {
+			t.Errorf("message %d:%d = %q, want %q", g, i, out, want.String())
+		}
+	}
+}
+
+// stripSGR removes SGR sequences from s.
+func stripSGR(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		if s[0] == '\033' {
+			s = s[strings.IndexByte(s, 'm')+1:]
+			continue
+		}
+		b.WriteByte(s[0])
+		s = s[1:]
+	}
+	return b.String()
+}
+
+// TestSyncChimpAllocs tests Surface scope that steady-state Write does not
+// allocate.
+func TestSyncChimpAllocs(t *testing.T) {
+	s := NewSync(io.Discard)
+	msg := []byte("[[Red]]error[[end]]: [[Bold]]details\n")
+	s.Write(msg)
+	if allocs := testing.AllocsPerRun(100, func() { s.Write(msg) }); allocs != 0 {
+		t.Errorf("Write() allocated %v times per call, want 0", allocs)
+	}
+}
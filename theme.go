@@ -0,0 +1,102 @@
+package chimp
+
+import (
+	"sort"
+	"strings"
+)
+
+// Theme maps alias names, such as "error" or "path", to the styles they stand
+// for, so markup can describe what text means rather than how it looks. An
+// alias may refer to other aliases. Alias names are matched exactly and take
+// precedence over styles of the same name.
+type Theme struct {
+	aliases map[string][]Style // Styles of each alias, with aliases resolved
+}
+
+// NewTheme creates a Theme from alias definitions. It returns a
+// *ThemeCycleError if an alias refers back to itself, directly or through
+// other aliases.
+func NewTheme(aliases map[string][]Style) (*Theme, error) {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Report the same cycle every time
+
+	t := &Theme{aliases: make(map[string][]Style, len(aliases))}
+	for _, name := range names {
+		if err := t.resolve(aliases, name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// resolve stores the styles of the alias name, resolving the aliases it
+// refers to first. path lists the aliases being resolved.
+func (t *Theme) resolve(aliases map[string][]Style, name string, path []string) error {
+	if _, ok := t.aliases[name]; ok {
+		return nil
+	}
+	for i, p := range path {
+		if p == name {
+			return &ThemeCycleError{Cycle: append(append([]string(nil), path[i:]...), name)}
+		}
+	}
+	path = append(path, name)
+
+	var styles []Style
+	for _, style := range aliases[name] {
+		ref := strings.TrimSpace(string(style))
+		if _, ok := aliases[ref]; !ok {
+			styles = append(styles, Style(ref))
+			continue
+		}
+		if err := t.resolve(aliases, ref, path); err != nil {
+			return err
+		}
+		styles = append(styles, t.aliases[ref]...)
+	}
+	t.aliases[name] = styles
+	return nil
+}
+
+// Resolve returns the styles the alias name stands for, with any aliases they
+// refer to resolved, and reports whether name is an alias.
+func (t *Theme) Resolve(name string) ([]Style, bool) {
+	styles, ok := t.alias(name)
+	return append([]Style(nil), styles...), ok
+}
+
+// alias returns the resolved styles of the alias name. t may be nil.
+func (t *Theme) alias(name string) ([]Style, bool) {
+	if t == nil {
+		return nil, false
+	}
+	styles, ok := t.aliases[name]
+	return styles, ok
+}
+
+// WithTheme makes a Chimp resolve the aliases of t in style tags. Swapping the
+// theme, for example between light and dark terminals, changes the rendering
+// of aliased markup without changing the markup itself.
+func WithTheme(t *Theme) Option {
+	return func(c *Chimp) {
+		c.theme = t
+	}
+}
+
+// expand returns the trimmed styles listed in the text of a style tag, with
+// aliases replaced by the styles they stand for. t may be nil.
+func (t *Theme) expand(styleText string) []Style {
+	var styles []Style
+	for _, part := range splitStyleList(styleText) {
+		name := strings.TrimSpace(part)
+		if resolved, ok := t.alias(name); ok {
+			styles = append(styles, resolved...)
+			continue
+		}
+		styles = append(styles, Style(name))
+	}
+	return styles
+}
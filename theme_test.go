@@ -0,0 +1,143 @@
+package chimp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestNewTheme tests Surface scope alias resolution and cycle detection.
+func TestNewTheme(t *testing.T) {
+	theme, err := NewTheme(map[string][]Style{
+		"error":   {StyleBold, StyleBrightRed},
+		"fatal":   {"error", StyleUnderline},
+		"path":    {" Cyan "},
+		"nothing": {},
+	})
+	if err != nil {
+		t.Fatalf("NewTheme() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		want   []Style
+		wantOK bool
+	}{
+		{"error", []Style{StyleBold, StyleBrightRed}, true},
+		{"fatal", []Style{StyleBold, StyleBrightRed, StyleUnderline}, true},
+		{"path", []Style{StyleCyan}, true},
+		{"nothing", nil, true},
+		{"Error", nil, false},
+		{"Red", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := theme.Resolve(tt.name)
+		if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolve(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	var nilTheme *Theme
+	if got, ok := nilTheme.Resolve("error"); got != nil || ok {
+		t.Errorf("nil Resolve() = %q, %v, want nil, false", got, ok)
+	}
+
+	cycles := []struct {
+		aliases map[string][]Style
+		want    []string
+	}{
+		{map[string][]Style{"a": {"a"}}, []string{"a", "a"}},
+		{map[string][]Style{"a": {StyleRed, "b"}, "b": {"c"}, "c": {"a"}}, []string{"a", "b", "c", "a"}},
+		{map[string][]Style{"a": {"b"}, "b": {"c"}, "c": {"b"}}, []string{"b", "c", "b"}},
+	}
+	for _, tt := range cycles {
+		_, err := NewTheme(tt.aliases)
+		var cycle *ThemeCycleError
+		if !errors.As(err, &cycle) {
+			t.Errorf("NewTheme(%v) error = %v, want *ThemeCycleError", tt.aliases, err)
+			continue
+		}
+		if !reflect.DeepEqual(cycle.Cycle, tt.want) {
+			t.Errorf("NewTheme(%v) cycle = %q, want %q", tt.aliases, cycle.Cycle, tt.want)
+		}
+	}
+	if got, want := (&ThemeCycleError{Cycle: []string{"a", "b", "a"}}).Error(), "theme alias cycle: a -> b -> a"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+// TestWriteTheme tests Surface scope rendering of aliases by each backend.
+func TestWriteTheme(t *testing.T) {
+	dark, _ := NewTheme(map[string][]Style{
+		"error": {StyleBold, StyleBrightRed},
+		"path":  {StyleCyan},
+	})
+	light, _ := NewTheme(map[string][]Style{
+		"error": {StyleBold, StyleRed},
+		"path":  {StyleBlue, StyleUnderline},
+	})
+	input := "[[error]]open [[path]]a.txt[[end]]: denied[[end]]"
+
+	tests := []struct {
+		name  string
+		newFn func(*bytes.Buffer) *Chimp
+		want  string
+	}{
+		{
+			name:  "Dark",
+			newFn: func(b *bytes.Buffer) *Chimp { return New(b, WithTheme(dark), WithStrict()) },
+			want:  "\033[1;91mopen \033[36ma.txt\033[91m: denied\033[0m",
+		},
+		{
+			name:  "Light",
+			newFn: func(b *bytes.Buffer) *Chimp { return New(b, WithTheme(light), WithStrict()) },
+			want:  "\033[1;31mopen \033[4;34ma.txt\033[24;31m: denied\033[0m",
+		},
+		{
+			name:  "No theme",
+			newFn: func(b *bytes.Buffer) *Chimp { return New(b) },
+			want:  "open a.txt: denied",
+		},
+		{
+			name:  "HTML",
+			newFn: func(b *bytes.Buffer) *Chimp { return NewHTML(b, WithTheme(dark)) },
+			want: `<span style="font-weight:bold;color:#ff0000">open ` +
+				`<span style="color:#00cdcd">a.txt</span>: denied</span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := tt.newFn(&buf)
+			if _, err := c.Write([]byte(input)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	_, err := New(&buf, WithTheme(dark), WithStrict()).Write([]byte("[[error, Gren]]x"))
+	var unknown *UnknownStyleError
+	if !errors.As(err, &unknown) || unknown.Pos.Column != 10 {
+		t.Errorf("Write() with strict mode error = %v, want *UnknownStyleError at 1:10", err)
+	}
+
+	typo, _ := NewTheme(map[string][]Style{"err": {"Gren"}})
+	_, err = New(&buf, WithTheme(typo), WithStrict()).Write([]byte("x [[err]]y"))
+	if !errors.As(err, &unknown) || unknown.Name != "Gren" || unknown.Pos.Column != 5 {
+		t.Errorf("Write() with strict mode and a bad alias error = %v, want *UnknownStyleError for Gren at 1:5", err)
+	}
+
+	backend, _ := NewTheme(map[string][]Style{"backend": {StyleGreen}})
+	buf.Reset()
+	if _, err := New(&buf, WithTheme(backend), WithStrict()).Write([]byte("[[Red]]a[[backend]]b[[end]]c")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got, want := buf.String(), "\033[31ma\033[32mb\033[31mc"; got != want {
+		t.Errorf("Write() with alias ending in end wrote %q, want %q", got, want)
+	}
+}
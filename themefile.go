@@ -0,0 +1,349 @@
+package chimp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// LoadThemeFile reads a theme from the named file. Files with a ".json"
+// extension are read as by LoadThemeJSON and all others as by LoadTheme.
+func LoadThemeFile(path string) (*Theme, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return LoadThemeJSON(f, path)
+	}
+	return LoadTheme(f, path)
+}
+
+// LoadTheme reads a theme written as one alias per line:
+//
+//	# Comments and blank lines are ignored.
+//	error = Bold, BrightRed
+//	fatal = error, Underline
+//
+// Each style must be a recognized style or an alias defined in the same
+// theme. Problems are reported together in a *ThemeLoadError naming file,
+// which is used only for messages.
+func LoadTheme(r io.Reader, file string) (*Theme, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	l := &themeLoader{data: data}
+	l.parseLines()
+	return l.theme(file)
+}
+
+// LoadThemeJSON reads a theme written as a JSON object mapping each alias to
+// an array of styles or to a comma-separated string of styles:
+//
+//	{"error": ["Bold", "BrightRed"], "fatal": "error, Underline"}
+//
+// It is otherwise like LoadTheme.
+func LoadThemeJSON(r io.Reader, file string) (*Theme, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	l := &themeLoader{data: data}
+	l.parseJSON()
+	return l.theme(file)
+}
+
+// themeDef is an alias definition read from a theme file.
+type themeDef struct {
+	name      string
+	pos       Position
+	styles    []Style
+	stylesPos []Position
+}
+
+// themeLoader collects the alias definitions and errors of a theme file.
+type themeLoader struct {
+	data []byte
+	defs []themeDef
+	errs []error
+}
+
+// theme validates the definitions read and builds the Theme.
+func (l *themeLoader) theme(file string) (*Theme, error) {
+	aliases := make(map[string][]Style, len(l.defs))
+	for _, def := range l.defs {
+		if _, ok := aliases[def.name]; ok {
+			l.errs = append(l.errs, &ThemeSyntaxError{Msg: fmt.Sprintf("duplicate alias %q", def.name), Pos: def.pos})
+			continue
+		}
+		aliases[def.name] = def.styles
+	}
+	for _, def := range l.defs {
+		for i, style := range def.styles {
+			if _, ok := aliases[string(style)]; ok {
+				continue
+			}
+			if err := styleError(string(style), def.stylesPos[i]); err != nil {
+				l.errs = append(l.errs, err)
+			}
+		}
+	}
+	l.findCycles(aliases)
+
+	sort.SliceStable(l.errs, func(i, j int) bool {
+		return errorOffset(l.errs[i]) < errorOffset(l.errs[j])
+	})
+	if len(l.errs) > 0 {
+		return nil, &ThemeLoadError{File: file, Errors: l.errs}
+	}
+	return NewTheme(aliases)
+}
+
+// findCycles records a *ThemeCycleError for every reference that closes a
+// cycle of aliases, at the definition making it. Definitions are followed in
+// file order.
+func (l *themeLoader) findCycles(aliases map[string][]Style) {
+	defs := make(map[string]*themeDef, len(l.defs)) // first definition of each alias
+	for i := range l.defs {
+		if _, ok := defs[l.defs[i].name]; !ok {
+			defs[l.defs[i].name] = &l.defs[i]
+		}
+	}
+
+	done := make(map[string]bool, len(aliases))
+	var path []string // aliases being visited
+	var visit func(name string)
+	visit = func(name string) {
+		path = append(path, name)
+	refs:
+		for _, style := range aliases[name] {
+			ref := string(style)
+			if _, ok := aliases[ref]; !ok || done[ref] {
+				continue
+			}
+			for i, p := range path {
+				if p == ref {
+					l.errs = append(l.errs, &ThemeCycleError{
+						Cycle: append(append([]string(nil), path[i:]...), ref),
+						Pos:   defs[name].pos,
+					})
+					continue refs
+				}
+			}
+			visit(ref)
+		}
+		path = path[:len(path)-1]
+		done[name] = true
+	}
+	for _, def := range l.defs {
+		if !done[def.name] {
+			visit(def.name)
+		}
+	}
+}
+
+// errorOffset returns the offset of the problem reported by err, a
+// *ThemeSyntaxError, *UnknownStyleError, *InvalidColorError or
+// *ThemeCycleError.
+func errorOffset(err error) int {
+	switch err := err.(type) {
+	case *ThemeSyntaxError:
+		return err.Pos.Offset
+	case *UnknownStyleError:
+		return err.Pos.Offset
+	case *InvalidColorError:
+		return err.Pos.Offset
+	case *ThemeCycleError:
+		return err.Pos.Offset
+	}
+	return 0
+}
+
+// position returns the position of the byte at offset in the file.
+func (l *themeLoader) position(offset int) Position {
+	pos := Position{Line: 1, Column: 1}
+	pos.advance(l.data[:offset])
+	return pos
+}
+
+// addStyles appends the styles of a comma-separated list to def. offset
+// returns the file offset of each byte of list. Empty entries are skipped.
+func (l *themeLoader) addStyles(def *themeDef, list string, offset func(i int) int) {
+	i := 0
+	for _, part := range splitStyleList(list) {
+		if name := strings.TrimSpace(part); name != "" {
+			def.styles = append(def.styles, Style(name))
+			def.stylesPos = append(def.stylesPos, l.position(offset(i+strings.Index(part, name))))
+		}
+		i += len(part) + len(",")
+	}
+}
+
+// parseLines reads definitions in the key=value format.
+func (l *themeLoader) parseLines() {
+	offset := 0
+	for _, line := range strings.SplitAfter(string(l.data), "\n") {
+		start := offset
+		offset += len(line)
+		text := strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		eq := strings.IndexByte(text, '=')
+		name := ""
+		if eq >= 0 {
+			name = strings.TrimSpace(text[:eq])
+		}
+		if name == "" {
+			pos := l.position(start + strings.Index(text, trimmed))
+			l.errs = append(l.errs, &ThemeSyntaxError{Msg: "expected alias = styles", Pos: pos})
+			continue
+		}
+		def := themeDef{name: name, pos: l.position(start + strings.Index(text, name))}
+		base := start + eq + 1
+		l.addStyles(&def, text[eq+1:], func(i int) int { return base + i })
+		l.defs = append(l.defs, def)
+	}
+}
+
+// parseJSON reads definitions in the JSON format. Decoding stops at the first
+// syntax error.
+func (l *themeLoader) parseJSON() {
+	dec := json.NewDecoder(bytes.NewReader(l.data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		l.jsonError(err, l.skipSpace(0), "theme must be a JSON object")
+		return
+	}
+	for dec.More() {
+		keyOffset := l.skipSpace(int(dec.InputOffset()))
+		tok, err := dec.Token()
+		if err != nil {
+			l.jsonError(err, keyOffset, "")
+			return
+		}
+		def := themeDef{name: tok.(string), pos: l.position(keyOffset)}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			l.jsonError(err, l.skipSpace(int(dec.InputOffset())), "")
+			return
+		}
+		if l.addJSONStyles(&def, raw, int(dec.InputOffset())-len(raw)) {
+			l.defs = append(l.defs, def)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		l.jsonError(err, l.skipSpace(int(dec.InputOffset())), "")
+		return
+	}
+	if offset := l.skipSpace(int(dec.InputOffset())); offset < len(l.data) {
+		l.jsonError(nil, offset, "unexpected data after theme")
+	}
+}
+
+// addJSONStyles appends the styles of the JSON value raw found at offset to
+// def. It reports whether the value was a string or an array of strings.
+func (l *themeLoader) addJSONStyles(def *themeDef, raw json.RawMessage, offset int) bool {
+	if list, offsets, ok := jsonString(raw, offset); ok {
+		l.addStyles(def, list, func(i int) int { return offsets[i] })
+		return true
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err == nil && tok == json.Delim('[') {
+		strs := true
+		for strs && dec.More() {
+			var elem json.RawMessage
+			if strs = dec.Decode(&elem) == nil; strs {
+				var list string
+				var offsets []int
+				list, offsets, strs = jsonString(elem, offset+int(dec.InputOffset())-len(elem))
+				if strs {
+					l.addStyles(def, list, func(i int) int { return offsets[i] })
+				}
+			}
+		}
+		if strs {
+			return true
+		}
+	}
+	l.errs = append(l.errs, &ThemeSyntaxError{
+		Msg: fmt.Sprintf("alias %q must be a string or an array of strings", def.name),
+		Pos: l.position(offset),
+	})
+	return false
+}
+
+// jsonString decodes the JSON string raw found at offset. It returns the
+// string, the file offset of each of its bytes, which differ from their
+// positions in raw after escapes such as "\u0042" or "\"", and whether raw was
+// a string.
+func jsonString(raw []byte, offset int) (s string, offsets []int, ok bool) {
+	if len(raw) == 0 || raw[0] != '"' || json.Unmarshal(raw, &s) != nil { // Unmarshal accepts null
+		return "", nil, false
+	}
+	offsets = make([]int, 0, len(s))
+	for i := len(`"`); i < len(raw)-len(`"`); {
+		n := 1
+		switch {
+		case raw[i] == '\\' && raw[i+1] == 'u':
+			n = len(`\u0000`)
+			if end := i + 2*n; end < len(raw) && raw[i+n] == '\\' && utf8.RuneCountInString(jsonPiece(raw[i:end])) == 1 {
+				n *= 2 // Surrogate pair
+			}
+		case raw[i] == '\\':
+			n = len(`\n`)
+		case raw[i] >= utf8.RuneSelf:
+			_, n = utf8.DecodeRune(raw[i:])
+		}
+		for j := len(jsonPiece(raw[i : i+n])); j > 0; j-- {
+			offsets = append(offsets, offset+i)
+		}
+		i += n
+	}
+	return s, offsets, true
+}
+
+// jsonPiece decodes part of the contents of a JSON string.
+func jsonPiece(piece []byte) string {
+	var s string
+	json.Unmarshal(append(append([]byte(`"`), piece...), '"'), &s)
+	return s
+}
+
+// jsonError records a decoding error found at offset, or msg if err is nil.
+// Syntax errors carry their own offset.
+func (l *themeLoader) jsonError(err error, offset int, msg string) {
+	var syntax *json.SyntaxError
+	switch {
+	case errors.As(err, &syntax):
+		msg, offset = syntax.Error(), int(syntax.Offset)
+		if offset > 0 && !strings.HasSuffix(msg, "end of JSON input") {
+			offset-- // Offset follows the bad byte
+		}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		msg, offset = "unexpected end of JSON input", len(l.data)
+	case err != nil:
+		msg = err.Error()
+	}
+	l.errs = append(l.errs, &ThemeSyntaxError{Msg: msg, Pos: l.position(offset)})
+}
+
+// skipSpace returns the offset of the first byte at or after offset that is
+// not JSON whitespace or a separator.
+func (l *themeLoader) skipSpace(offset int) int {
+	for offset < len(l.data) && strings.IndexByte(" \t\r\n:,", l.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
@@ -0,0 +1,210 @@
+package chimp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLoadTheme tests Surface scope loading of valid themes in each format.
+func TestLoadTheme(t *testing.T) {
+	want := map[string][]Style{
+		"error": {StyleBold, StyleBrightRed},
+		"fatal": {StyleBold, StyleBrightRed, StyleUnderline},
+		"path":  {"Color(45)"},
+	}
+	tests := []struct {
+		name  string
+		load  func(string) (*Theme, error)
+		input string
+	}{
+		{
+			name: "Key value",
+			load: func(s string) (*Theme, error) { return LoadTheme(strings.NewReader(s), "") },
+			input: "# Dark terminals\n" +
+				"error = Bold, BrightRed\r\n" +
+				"\n" +
+				"  fatal=error,Underline\n" +
+				"path = Color(45)",
+		},
+		{
+			name: "JSON",
+			load: func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "") },
+			input: `{
+				"error": ["Bold", "BrightRed"],
+				"fatal": "error, Underline",
+				"path": ["Color(45)"]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theme, err := tt.load(tt.input)
+			if err != nil {
+				t.Fatalf("load error = %v", err)
+			}
+			for name, styles := range want {
+				if got, _ := theme.Resolve(name); !reflect.DeepEqual(got, styles) {
+					t.Errorf("Resolve(%q) = %q, want %q", name, got, styles)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadThemeErrors tests Surface scope reporting of every problem in a
+// theme file with its position.
+func TestLoadThemeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		load  func(string) (*Theme, error)
+		input string
+		want  []string
+	}{
+		{
+			name: "Key value",
+			load: func(s string) (*Theme, error) { return LoadTheme(strings.NewReader(s), "dark.theme") },
+			input: "error = Bold, BrightRed\n" +
+				"  oops\n" +
+				"path = Cyan, Gren\n" +
+				" = Red\n" +
+				"error = Red\n" +
+				"a = b\n" +
+				"b = Bg(256), a\n" +
+				"c = d\n" +
+				"d = c, d\n",
+			want: []string{
+				`dark.theme: expected alias = styles at 2:3`,
+				`dark.theme: unknown style "Gren" at 3:14; did you mean "Green"?`,
+				`dark.theme: expected alias = styles at 4:2`,
+				`dark.theme: duplicate alias "error" at 5:1`,
+				`dark.theme: theme alias cycle: a -> b -> a at 7:1`,
+				`dark.theme: invalid color argument "256" in "Bg(256)" at 7:5`,
+				`dark.theme: theme alias cycle: c -> d -> c at 9:1`,
+				`dark.theme: theme alias cycle: d -> d at 9:1`,
+			},
+		},
+		{
+			name: "JSON values",
+			load: func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "dark.json") },
+			input: "{\n" +
+				"  \"error\": [\"Bold\", \"Gren\"],\n" +
+				"  \"path\": \"Cyan, Color(300)\",\n" +
+				"  \"count\": 3,\n" +
+				"  \"list\": [\"Red\", [\"Blue\"]]\n" +
+				"}",
+			want: []string{
+				`dark.json: unknown style "Gren" at 2:22; did you mean "Green"?`,
+				`dark.json: invalid color argument "300" in "Color(300)" at 3:18`,
+				`dark.json: alias "count" must be a string or an array of strings at 4:12`,
+				`dark.json: alias "list" must be a string or an array of strings at 5:11`,
+			},
+		},
+		{
+			name:  "JSON null",
+			load:  func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "") },
+			input: `{"error": null, "warn": [null, "Bold"]}`,
+			want: []string{
+				`alias "error" must be a string or an array of strings at 1:11`,
+				`alias "warn" must be a string or an array of strings at 1:25`,
+			},
+		},
+		{
+			name: "JSON escapes",
+			load: func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "") },
+			input: `{"a": "\u0042old, Gren",` + "\n" +
+				` "b": ["\t Blu", "\ud83d\ude00\"X"]}`,
+			want: []string{
+				`unknown style "Gren" at 1:19; did you mean "Green"?`,
+				`unknown style "Blu" at 2:12; did you mean "Blue"?`,
+				`unknown style "😀\"X" at 2:19`,
+			},
+		},
+		{
+			name:  "JSON syntax",
+			load:  func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "dark.json") },
+			input: "{\n  \"a\": \"Red\" x\n}",
+			want:  []string{`dark.json: invalid character 'x' after object key:value pair at 2:14`},
+		},
+		{
+			name:  "JSON truncated",
+			load:  func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "") },
+			input: "{\n  \"a\": \"Red\",\n",
+			want:  []string{`unexpected end of JSON input at 3:1`},
+		},
+		{
+			name:  "JSON not an object",
+			load:  func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "") },
+			input: ` ["Red"]`,
+			want:  []string{`theme must be a JSON object at 1:2`},
+		},
+		{
+			name:  "JSON trailing data",
+			load:  func(s string) (*Theme, error) { return LoadThemeJSON(strings.NewReader(s), "") },
+			input: `{"a": "Red"} {}`,
+			want:  []string{`unexpected data after theme at 1:14`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theme, err := tt.load(tt.input)
+			if theme != nil {
+				t.Errorf("load returned a theme with error %v", err)
+			}
+			var loadErr *ThemeLoadError
+			if !errors.As(err, &loadErr) {
+				t.Fatalf("load error = %v, want *ThemeLoadError", err)
+			}
+			if got, want := err.Error(), strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("Error() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+
+	_, err := LoadTheme(strings.NewReader("a = Gren"), "")
+	var unknown *UnknownStyleError
+	if !errors.As(err, &unknown) || unknown.Pos != (Position{Offset: 4, Line: 1, Column: 5}) {
+		t.Errorf("errors.As(%v) = %+v, want *UnknownStyleError at 1:5", err, unknown)
+	}
+}
+
+// TestLoadThemeFile tests Surface scope format selection by file extension.
+func TestLoadThemeFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"theme.json":  `{"error": "Red"}`,
+		"theme.conf":  "error = Red",
+		"broken.JSON": "error = Red",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"theme.json", "theme.conf"} {
+		theme, err := LoadThemeFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("LoadThemeFile(%q) error = %v", name, err)
+			continue
+		}
+		if got, _ := theme.Resolve("error"); !reflect.DeepEqual(got, []Style{StyleRed}) {
+			t.Errorf("LoadThemeFile(%q) error alias = %q, want [Red]", name, got)
+		}
+	}
+
+	path := filepath.Join(dir, "broken.JSON")
+	_, err := LoadThemeFile(path)
+	var loadErr *ThemeLoadError
+	if !errors.As(err, &loadErr) || loadErr.File != path {
+		t.Errorf("LoadThemeFile(%q) error = %v, want *ThemeLoadError for the file", path, err)
+	}
+	if _, err := LoadThemeFile(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadThemeFile() of a missing file error = %v, want os.ErrNotExist", err)
+	}
+}